@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/mortenson/pg-autojoin/internal/dbinfo"
 	"github.com/mortenson/pg-autojoin/internal/join"
 	"github.com/mortenson/pg-autojoin/internal/proxy"
 )
@@ -22,7 +23,13 @@ func main() {
 	proxyPointer := flag.String("proxy", "127.0.0.1:5432", "remote postgres server address")
 	prefix := flag.Bool("prefix", true, "prefix row descriptors with the newly joined table (ex: email => users_email)")
 	cacheTTL := flag.Int("cachettl", 60*60, "the maximum number of seconds database schema should be cached")
-	joinTypePtr := flag.String("jointype", "inner", "default join type (inner or left)")
+	joinTypePtr := flag.String("jointype", "inner", "default join type (inner, left, auto, or aggregate)")
+	schemaFilePtr := flag.String("schema-file", "", "read schema from a file of DDL statements instead of DATABASE_URL")
+	migrationsDirPtr := flag.String("migrations-dir", "", "read schema by applying a directory of migrations instead of DATABASE_URL")
+	databasePtr := flag.String("database", "", "only join queries to this database, required if DATABASE_URL isn't set")
+	snapshotPtr := flag.String("snapshot", "", "read schema from a snapshot made by \"pg-autojoin schema dump\" instead of DATABASE_URL")
+	relationshipsPtr := flag.String("relationships", "", "YAML or JSON file of relationships to join on that aren't real foreign keys")
+	inferPtr := flag.Bool("infer", false, "infer foreign keys from column names (ex: orders.customer_id -> customers.id)")
 	onlyJoinGlobalPtr := flag.Bool("onlyjoin", false, "only respond to AUTOJOIN queries, pass all other queries through untouched")
 	help := flag.Bool("help", false, "show help")
 	flag.Parse()
@@ -39,18 +46,45 @@ func main() {
 	var joinBehavior join.JoinBehavior
 	if *joinTypePtr == "left" {
 		joinBehavior = join.JoinBehaviorLeftJoin
+	} else if *joinTypePtr == "auto" {
+		joinBehavior = join.JoinBehaviorAuto
+	} else if *joinTypePtr == "aggregate" {
+		joinBehavior = join.JoinBehaviorAggregate
 	} else {
 		joinBehavior = join.JoinBehaviorInnerJoin
 	}
 
-	dburl := os.Getenv("DATABASE_URL")
-	if dburl == "" {
-		slog.Error("DATABASE_URL env variable is required")
+	// Only queries to the database the schema is for are joined, which is
+	// either the DATABASE_URL database or --database.
+	schemaSource := dbinfo.SchemaSource{
+		SchemaFile:        *schemaFilePtr,
+		MigrationsDir:     *migrationsDirPtr,
+		SnapshotFile:      *snapshotPtr,
+		RelationshipsFile: *relationshipsPtr,
+		InferForeignKeys:  *inferPtr,
+	}
+	if err := schemaSource.Validate(); err != nil {
+		slog.Error("Could not read schema", slog.Any("error", err))
 		os.Exit(1)
 	}
-	parsedConfigFromDbUrl, err := pgx.ParseConfig(dburl)
-	if err != nil || parsedConfigFromDbUrl.Database == "" {
-		slog.Error("Could not parse DATABASE_URL to determine what database you want to proxy")
+	dburl := os.Getenv("DATABASE_URL")
+	databaseName := *databasePtr
+	if dburl == "" && schemaSource.Path() == "" {
+		slog.Error("DATABASE_URL env variable, --schema-file, --migrations-dir, or --snapshot is required")
+		os.Exit(1)
+	} else if dburl != "" {
+		parsedConfigFromDbUrl, err := pgx.ParseConfig(dburl)
+		if err != nil || parsedConfigFromDbUrl.Database == "" {
+			slog.Error("Could not parse DATABASE_URL to determine what database you want to proxy")
+			os.Exit(1)
+		}
+		if databaseName != "" && databaseName != parsedConfigFromDbUrl.Database {
+			slog.Error("--database does not match the DATABASE_URL database")
+			os.Exit(1)
+		}
+		databaseName = parsedConfigFromDbUrl.Database
+	} else if databaseName == "" {
+		slog.Error("--database is required when DATABASE_URL isn't set, to know which database the schema is for")
 		os.Exit(1)
 	}
 
@@ -74,8 +108,9 @@ func main() {
 	}
 
 	server := proxy.NewProxyServer(proxy.ProxyServerConfig{
-		DatabaseName:                 parsedConfigFromDbUrl.Database,
+		DatabaseName:                 databaseName,
 		DatabaseUrl:                  dburl,
+		SchemaSource:                 schemaSource,
 		OnlyRespondToAutoJoins:       *onlyJoinGlobalPtr,
 		ShouldPrefixFieldDescriptors: *prefix,
 		ProxyAddress:                 *proxyPointer,
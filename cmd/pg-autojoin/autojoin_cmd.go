@@ -16,10 +16,17 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		runSchemaCommand(os.Args[2:])
+		return
+	}
+
 	verbosePtr := flag.Bool("verbose", false, "enable verbose output")
 	noExec := flag.Bool("noexec", false, "do not execute generated query")
 	help := flag.Bool("help", false, "show help")
-	joinTypePtr := flag.String("jointype", "inner", "default join type (inner or left)")
+	joinTypePtr := flag.String("jointype", "inner", "default join type (inner, left, auto, or aggregate)")
+	searchPathPtr := flag.String("searchpath", "", "search_path used to resolve unqualified tables (defaults to the connection's)")
+	schemaSource := addSchemaSourceFlags(flag.CommandLine)
 	flag.Parse()
 
 	if *help {
@@ -34,6 +41,10 @@ func main() {
 	var joinBehavior join.JoinBehavior
 	if *joinTypePtr == "left" {
 		joinBehavior = join.JoinBehaviorLeftJoin
+	} else if *joinTypePtr == "auto" {
+		joinBehavior = join.JoinBehaviorAuto
+	} else if *joinTypePtr == "aggregate" {
+		joinBehavior = join.JoinBehaviorAggregate
 	} else {
 		joinBehavior = join.JoinBehaviorInnerJoin
 	}
@@ -41,8 +52,12 @@ func main() {
 	args := flag.Args()
 
 	dburl := os.Getenv("DATABASE_URL")
-	if dburl == "" {
-		slog.Error("DATABASE_URL env variable is required")
+	if dburl == "" && schemaSource.source().Path() == "" {
+		slog.Error("DATABASE_URL env variable, --schema-file, --migrations-dir, or --snapshot is required")
+		os.Exit(1)
+	}
+	if dburl == "" && !*noExec {
+		slog.Error("DATABASE_URL env variable is required to execute queries, use --noexec to skip execution")
 		os.Exit(1)
 	}
 
@@ -54,26 +69,46 @@ func main() {
 	userQuery := args[0]
 
 	ctx := context.Background()
-	conn, err := pgx.Connect(ctx, dburl)
-	if err != nil {
-		slog.Error("Could not connect to database", slog.Any("error", err))
-		os.Exit(1)
+	var conn *pgx.Conn
+	var err error
+	if dburl != "" {
+		conn, err = pgx.Connect(ctx, dburl)
+		if err != nil {
+			slog.Error("Could not connect to database", slog.Any("error", err))
+			os.Exit(1)
+		}
+		defer conn.Close(ctx)
 	}
-	defer conn.Close(ctx)
 
-	// Gather information on what columns, tables, and fkeys exists.
-	databaseInfo, err := dbinfo.GetDatabaseInfoResult(ctx, conn)
+	databaseInfo, err := schemaSource.source().GetDatabaseInfo(ctx, conn)
 	if err != nil {
 		slog.Error("Could not gather table info", slog.Any("error", err))
 		os.Exit(1)
 	}
 
+	var searchPath []string
+	if *searchPathPtr != "" {
+		user := ""
+		if conn != nil {
+			user = conn.Config().User
+		}
+		searchPath = dbinfo.ParseSearchPath(*searchPathPtr, user)
+	} else if conn != nil {
+		searchPath, err = dbinfo.GetSearchPath(ctx, conn)
+		if err != nil {
+			slog.Error("Could not get search path", slog.Any("error", err))
+			os.Exit(1)
+		}
+	} else {
+		searchPath = dbinfo.ParseSearchPath(dbinfo.DefaultSearchPath, "")
+	}
+
 	parsedQuery, err := pg_query.Parse(userQuery)
 	if err != nil {
 		slog.Error("Could not parse query", slog.Any("error", err))
 		os.Exit(1)
 	}
-	_, err = join.AddMissingJoinsToQuery(parsedQuery, databaseInfo, joinBehavior)
+	joinPlan, err := join.AddMissingJoinsToQuery(parsedQuery, databaseInfo, joinBehavior, join.DefaultPathCost{}, searchPath)
 	if err != nil {
 		slog.Error("Could not add missing joins to query", slog.Any("error", err))
 		os.Exit(1)
@@ -87,6 +122,15 @@ func main() {
 	}
 	fmt.Printf("Old query:\n\t%s \n", userQuery)
 	fmt.Printf("New query:\n\t%s \n", deparse)
+	if len(joinPlan.Joins) > 0 {
+		fmt.Printf("Joins:\n")
+		for _, addedJoin := range joinPlan.Joins {
+			fmt.Printf("\t%s\n", addedJoin)
+		}
+	}
+	if joinPlan.MultipliesRows {
+		slog.Warn("Joins marked (to-many) can return more than one row for each row of the original query")
+	}
 
 	if *noExec {
 		return
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mortenson/pg-autojoin/internal/dbinfo"
+)
+
+// Flags for reading schema from somewhere other than DATABASE_URL.
+type schemaSourceFlags struct {
+	schemaFile    *string
+	migrationsDir *string
+	snapshot      *string
+	relationships *string
+	infer         *bool
+}
+
+func addSchemaSourceFlags(flagSet *flag.FlagSet) schemaSourceFlags {
+	return schemaSourceFlags{
+		schemaFile:    flagSet.String("schema-file", "", "read schema from a file of DDL statements instead of DATABASE_URL"),
+		migrationsDir: flagSet.String("migrations-dir", "", "read schema by applying a directory of migrations instead of DATABASE_URL"),
+		snapshot:      flagSet.String("snapshot", "", "read schema from a snapshot made by \"schema dump\" instead of DATABASE_URL"),
+		relationships: flagSet.String("relationships", "", "YAML or JSON file of relationships to join on that aren't real foreign keys"),
+		infer:         flagSet.Bool("infer", false, "infer foreign keys from column names (ex: orders.customer_id -> customers.id)"),
+	}
+}
+
+func (f schemaSourceFlags) source() dbinfo.SchemaSource {
+	return dbinfo.SchemaSource{
+		SchemaFile:        *f.schemaFile,
+		MigrationsDir:     *f.migrationsDir,
+		SnapshotFile:      *f.snapshot,
+		RelationshipsFile: *f.relationships,
+		InferForeignKeys:  *f.infer,
+	}
+}
+
+func runSchemaCommand(args []string) {
+	if len(args) == 0 {
+		slog.Error("Missing schema subcommand, expected \"dump\" or \"diff\"")
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "dump":
+		runSchemaDumpCommand(args[1:])
+	case "diff":
+		runSchemaDiffCommand(args[1:])
+	default:
+		slog.Error(fmt.Sprintf("Unknown schema subcommand %s, expected \"dump\" or \"diff\"", args[0]))
+		os.Exit(1)
+	}
+}
+
+// Writes a snapshot of the schema, which can be committed or shared with
+// people who can't reach the database.
+func runSchemaDumpCommand(args []string) {
+	flagSet := flag.NewFlagSet("schema dump", flag.ExitOnError)
+	outPtr := flagSet.String("out", "", "file to write the snapshot to (defaults to stdout)")
+	schemaSource := addSchemaSourceFlags(flagSet)
+	flagSet.Parse(args) //nolint:all
+
+	ctx := context.Background()
+	var conn *pgx.Conn
+	if schemaSource.source().Path() == "" {
+		dburl := os.Getenv("DATABASE_URL")
+		if dburl == "" {
+			slog.Error("DATABASE_URL env variable, --schema-file, --migrations-dir, or --snapshot is required")
+			os.Exit(1)
+		}
+		var err error
+		conn, err = pgx.Connect(ctx, dburl)
+		if err != nil {
+			slog.Error("Could not connect to database", slog.Any("error", err))
+			os.Exit(1)
+		}
+		defer conn.Close(ctx)
+	}
+
+	databaseInfo, err := schemaSource.source().GetDatabaseInfo(ctx, conn)
+	if err != nil {
+		slog.Error("Could not gather table info", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if *outPtr != "" {
+		out, err = os.Create(*outPtr)
+		if err != nil {
+			slog.Error("Could not create snapshot file", slog.Any("error", err))
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	err = dbinfo.Save(out, databaseInfo)
+	if err != nil {
+		slog.Error("Could not write snapshot", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+// Reads schema from a database url, migrations directory, snapshot (*.json),
+// or file of DDL statements.
+func getDatabaseInfoFromSource(ctx context.Context, source string) (dbinfo.DatabaseInfo, error) {
+	if strings.HasPrefix(source, "postgres://") || strings.HasPrefix(source, "postgresql://") {
+		conn, err := pgx.Connect(ctx, source)
+		if err != nil {
+			return dbinfo.DatabaseInfo{}, err
+		}
+		defer conn.Close(ctx)
+		return dbinfo.GetDatabaseInfoResult(ctx, conn)
+	}
+	fileInfo, err := os.Stat(source)
+	if err != nil {
+		return dbinfo.DatabaseInfo{}, err
+	}
+	if fileInfo.IsDir() {
+		return dbinfo.GetDatabaseInfoFromMigrations(source)
+	}
+	file, err := os.Open(source)
+	if err != nil {
+		return dbinfo.DatabaseInfo{}, err
+	}
+	defer file.Close()
+	if strings.HasSuffix(source, ".json") {
+		return dbinfo.Load(file)
+	}
+	ddl, err := io.ReadAll(file)
+	if err != nil {
+		return dbinfo.DatabaseInfo{}, err
+	}
+	return dbinfo.GetDatabaseInfoFromDDL(string(ddl))
+}
+
+// Shows what changed between two schemas, and which column names became (or
+// stopped being) ambiguous since that silently changes how queries are joined.
+func runSchemaDiffCommand(args []string) {
+	flagSet := flag.NewFlagSet("schema diff", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintln(flagSet.Output(), "Usage: pg-autojoin schema diff <from> <to>")
+		fmt.Fprintln(flagSet.Output(), "Sources can be database urls, migration directories, snapshots (*.json), or DDL files.")
+	}
+	flagSet.Parse(args) //nolint:all
+	if flagSet.NArg() != 2 {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	from, err := getDatabaseInfoFromSource(ctx, flagSet.Arg(0))
+	if err != nil {
+		slog.Error("Could not gather table info", slog.String("source", flagSet.Arg(0)), slog.Any("error", err))
+		os.Exit(1)
+	}
+	to, err := getDatabaseInfoFromSource(ctx, flagSet.Arg(1))
+	if err != nil {
+		slog.Error("Could not gather table info", slog.String("source", flagSet.Arg(1)), slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	diff := dbinfo.Diff(from, to)
+	if diff.IsEmpty() {
+		fmt.Println("No changes")
+		return
+	}
+	printDiffSection("Added tables", diff.AddedTables)
+	printDiffSection("Removed tables", diff.RemovedTables)
+	printDiffSection("Added columns", diff.AddedColumns)
+	printDiffSection("Removed columns", diff.RemovedColumns)
+	printDiffSection("Added foreign keys", diff.AddedForeignKeys)
+	printDiffSection("Removed foreign keys", diff.RemovedForeignKeys)
+	newlyAmbiguousColumns := []string{}
+	for _, column := range diff.NewlyAmbiguousColumns {
+		tableNames := slices.Sorted(slices.Values(to.ColumnToTable[column]))
+		newlyAmbiguousColumns = append(newlyAmbiguousColumns, fmt.Sprintf("%s (%s)", column, strings.Join(tableNames, ", ")))
+	}
+	printDiffSection("Columns that became ambiguous", newlyAmbiguousColumns)
+	printDiffSection("Columns that are no longer ambiguous", diff.NoLongerAmbiguousColumns)
+}
+
+func printDiffSection(title string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, line := range lines {
+		fmt.Printf("\t%s\n", line)
+	}
+}
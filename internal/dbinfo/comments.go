@@ -0,0 +1,91 @@
+package dbinfo
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Comments on tables, columns, and constraints can contain directives that
+// change how they're joined, one per line:
+//
+//	COMMENT ON TABLE audit_log IS '@autojoin ignore';
+//	COMMENT ON COLUMN orders.customer_ref IS '@autojoin references customers(external_id)';
+//	COMMENT ON CONSTRAINT orders_billing_address_id_fkey ON orders IS '@autojoin prefer';
+const directivePrefix = "@autojoin"
+
+// A comment on a table, or one of its columns or constraints.
+type objectComment struct {
+	Table      *TableInfo
+	Column     string
+	Constraint string
+	Comment    string
+}
+
+// Applies directives in comments. Invalid directives are logged and skipped,
+// since comments shouldn't stop the rest of the schema from being used.
+func applyCommentDirectives(tables map[string]*TableInfo, comments []objectComment, searchPath []string) {
+	for _, comment := range comments {
+		for _, line := range strings.Split(comment.Comment, "\n") {
+			_, directive, ok := strings.Cut(line, directivePrefix)
+			if !ok {
+				continue
+			}
+			err := applyCommentDirective(tables, comment, strings.Fields(directive), searchPath)
+			if err != nil {
+				slog.Warn("Could not apply comment directive", slog.String("table", QualifiedName(comment.Table.Schema, comment.Table.Name)), slog.String("directive", strings.TrimSpace(line)), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+func applyCommentDirective(tables map[string]*TableInfo, comment objectComment, args []string, searchPath []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing directive")
+	}
+	switch {
+	case args[0] == "ignore" && comment.Column == "" && comment.Constraint == "":
+		comment.Table.Ignored = true
+	case args[0] == "prefer" && comment.Constraint != "":
+		fkey, ok := comment.Table.ForeignKeys[comment.Constraint]
+		if !ok {
+			return fmt.Errorf("%s is not a foreign key", comment.Constraint)
+		}
+		fkey.Preferred = true
+	case args[0] == "references" && comment.Column != "" && len(args) > 1:
+		fkey, err := referencedForeignKey(tables, comment.Column, strings.Join(args[1:], " "), searchPath)
+		if err != nil {
+			return err
+		}
+		comment.Table.ForeignKeys[uniqueConstraintName(comment.Table, comment.Column, "declared")] = fkey
+	default:
+		return fmt.Errorf("unknown directive %s for this kind of comment", args[0])
+	}
+	return nil
+}
+
+// Parses "customers", "customers(id)", or "customers.id" into a declared
+// foreign key. Tables without a column are referenced by their primary key.
+func referencedForeignKey(tables map[string]*TableInfo, column string, reference string, searchPath []string) (*ForeignKey, error) {
+	databaseInfo := DatabaseInfo{Tables: tables}
+	var toTableName string
+	var toColumns []string
+	if qualifiedName, ok := databaseInfo.ResolveTable(reference, searchPath); ok {
+		toTableName = qualifiedName
+		toColumns = tables[qualifiedName].PrimaryKey
+	} else {
+		var err error
+		toTableName, toColumns, err = databaseInfo.parseRelationshipSide(reference, searchPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(toColumns) != 1 {
+		return nil, fmt.Errorf("could not determine a single referenced column of %s", toTableName)
+	}
+	return &ForeignKey{
+		ToTable:          toTableName,
+		ColumnConditions: [][2]string{{column, toColumns[0]}},
+		Declared:         true,
+	}, nil
+}
@@ -2,127 +2,591 @@ package dbinfo
 
 import (
 	"context"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
 
 	"github.com/dominikbraun/graph"
 	"github.com/jackc/pgx/v5"
+	pg_query "github.com/pganalyze/pg_query_go/v5"
 )
 
-const columnsWithForeignKeysQuery = `
-select col.table_name as table,
-       col.column_name,
-       COALESCE(rel.table_name, '') as primary_table,
-       COALESCE(rel.column_name, '') as primary_column,
-			 COALESCE(kcu.constraint_name, '')
-from information_schema.columns col
-left join (select kcu.constraint_schema, 
-                  kcu.constraint_name, 
-                  kcu.table_schema,
-                  kcu.table_name, 
-                  kcu.column_name, 
-                  kcu.ordinal_position,
-                  kcu.position_in_unique_constraint
-           from information_schema.key_column_usage kcu
-           join information_schema.table_constraints tco
-                on kcu.constraint_schema = tco.constraint_schema
-                and kcu.constraint_name = tco.constraint_name
-                and tco.constraint_type = 'FOREIGN KEY'
-          ) as kcu
-          on col.table_schema = kcu.table_schema
-          and col.table_name = kcu.table_name
-          and col.column_name = kcu.column_name
-left join information_schema.referential_constraints rco
-          on rco.constraint_name = kcu.constraint_name
-          and rco.constraint_schema = kcu.table_schema
-left join information_schema.key_column_usage rel
-          on rco.unique_constraint_name = rel.constraint_name
-          and rco.unique_constraint_schema = rel.constraint_schema
-          and rel.ordinal_position = kcu.position_in_unique_constraint
-where col.table_schema = 'public';
+// Shared by the queries below to skip system schemas.
+const userSchemasCondition = `n.nspname not in ('pg_catalog', 'information_schema')
+      and n.nspname not like 'pg\_toast%'
+      and n.nspname not like 'pg\_temp\_%'`
+
+// Reads the catalog directly since information_schema is slow on large
+// databases and hides tables the current role has no privileges on. Partitions
+// are skipped, since they're queried through their partitioned table.
+const columnsQuery = `
+select n.nspname as schema,
+       c.relname as table,
+       a.attname as column,
+       a.attnotnull as not_null,
+       greatest(c.reltuples, 0)::float8 as row_estimate
+from pg_catalog.pg_class c
+join pg_catalog.pg_namespace n on n.oid = c.relnamespace
+join pg_catalog.pg_attribute a on a.attrelid = c.oid
+where c.relkind in ('r', 'p', 'v', 'm', 'f')
+      and not c.relispartition
+      and a.attnum > 0
+      and not a.attisdropped
+      and ` + userSchemasCondition + `
+order by n.nspname, c.relname, a.attnum;
+`
+
+// conkey and confkey are parallel arrays, so unnesting them together keeps
+// composite keys ordered. Foreign keys on (or to) partitions are moved to the
+// root partitioned table, skipping the copies Postgres makes of foreign keys
+// on partitioned tables for each partition.
+const foreignKeysQuery = `
+select n.nspname as schema,
+       c.relname as table,
+       con.conname as constraint,
+       fn.nspname as primary_schema,
+       fc.relname as primary_table,
+       a.attname as column,
+       fa.attname as primary_column
+from pg_catalog.pg_constraint con
+join pg_catalog.pg_class c on c.oid = coalesce(pg_catalog.pg_partition_root(con.conrelid), con.conrelid)
+join pg_catalog.pg_namespace n on n.oid = c.relnamespace
+join pg_catalog.pg_class fc on fc.oid = coalesce(pg_catalog.pg_partition_root(con.confrelid), con.confrelid)
+join pg_catalog.pg_namespace fn on fn.oid = fc.relnamespace
+cross join lateral unnest(con.conkey, con.confkey) with ordinality as k(attnum, primary_attnum, position)
+join pg_catalog.pg_attribute a on a.attrelid = con.conrelid and a.attnum = k.attnum
+join pg_catalog.pg_attribute fa on fa.attrelid = con.confrelid and fa.attnum = k.primary_attnum
+where con.contype = 'f'
+      and con.conparentid = 0
+      and ` + userSchemasCondition + `
+order by n.nspname, c.relname, con.conname, k.position;
+`
+
+// Primary keys are used to infer foreign keys from column names.
+const primaryKeysQuery = `
+select n.nspname as schema,
+       c.relname as table,
+       a.attname as column
+from pg_catalog.pg_constraint con
+join pg_catalog.pg_class c on c.oid = con.conrelid
+join pg_catalog.pg_namespace n on n.oid = c.relnamespace
+cross join lateral unnest(con.conkey) with ordinality as k(attnum, position)
+join pg_catalog.pg_attribute a on a.attrelid = con.conrelid and a.attnum = k.attnum
+where con.contype = 'p'
+      and ` + userSchemasCondition + `
+order by n.nspname, c.relname, k.position;
+`
+
+// Unique constraints and indexes tell if a foreign key is one-to-one. Partial
+// and expression indexes are skipped, since they can't be used for that.
+const uniqueKeysQuery = `
+select n.nspname as schema,
+       c.relname as table,
+       ic.relname as index,
+       a.attname as column
+from pg_catalog.pg_index i
+join pg_catalog.pg_class c on c.oid = i.indrelid
+join pg_catalog.pg_namespace n on n.oid = c.relnamespace
+join pg_catalog.pg_class ic on ic.oid = i.indexrelid
+cross join lateral unnest(i.indkey::int2[]) with ordinality as k(attnum, position)
+join pg_catalog.pg_attribute a on a.attrelid = c.oid and a.attnum = k.attnum
+where i.indisunique
+      and not i.indisprimary
+      and i.indpred is null
+      and i.indexprs is null
+      and k.position <= i.indnkeyatts
+      and not c.relispartition
+      and ` + userSchemasCondition + `
+order by n.nspname, c.relname, ic.relname, k.position;
+`
+
+// Comments on tables, columns, and foreign keys that contain directives.
+const commentsQuery = `
+select n.nspname as schema,
+       c.relname as table,
+       coalesce(a.attname, '') as column,
+       '' as constraint,
+       d.description as comment
+from pg_catalog.pg_description d
+join pg_catalog.pg_class c on c.oid = d.objoid
+join pg_catalog.pg_namespace n on n.oid = c.relnamespace
+left join pg_catalog.pg_attribute a on a.attrelid = c.oid and a.attnum = d.objsubid and d.objsubid > 0
+where d.classoid = 'pg_catalog.pg_class'::regclass
+      and d.description like '%@autojoin%'
+      and ` + userSchemasCondition + `
+union all
+select n.nspname as schema,
+       c.relname as table,
+       '' as column,
+       con.conname as constraint,
+       d.description as comment
+from pg_catalog.pg_description d
+join pg_catalog.pg_constraint con on con.oid = d.objoid
+join pg_catalog.pg_class c on c.oid = con.conrelid
+join pg_catalog.pg_namespace n on n.oid = c.relnamespace
+where d.classoid = 'pg_catalog.pg_constraint'::regclass
+      and d.description like '%@autojoin%'
+      and ` + userSchemasCondition + `
+order by 1, 2, 3, 4;
+`
+
+// Tables that inherit from other tables using INHERITS, which unlike
+// partitions can have their own columns and be queried on their own.
+const inheritsQuery = `
+select n.nspname as schema,
+       c.relname as table,
+       pn.nspname as parent_schema,
+       pc.relname as parent_table
+from pg_catalog.pg_inherits i
+join pg_catalog.pg_class c on c.oid = i.inhrelid
+join pg_catalog.pg_namespace n on n.oid = c.relnamespace
+join pg_catalog.pg_class pc on pc.oid = i.inhparent
+join pg_catalog.pg_namespace pn on pn.oid = pc.relnamespace
+where c.relkind in ('r', 'p', 'f')
+      and not c.relispartition
+      and ` + userSchemasCondition + `
+order by n.nspname, c.relname, i.inhseqno;
+`
+
+// Views are parsed to find columns that pass through table columns.
+const viewsQuery = `
+select n.nspname as schema,
+       c.relname as view,
+       pg_catalog.pg_get_viewdef(c.oid) as definition
+from pg_catalog.pg_class c
+join pg_catalog.pg_namespace n on n.oid = c.relnamespace
+where c.relkind in ('v', 'm')
+      and ` + userSchemasCondition + `;
 `
 
+const searchPathQuery = `select current_schemas(false);`
+
+// The search_path Postgres uses when a client doesn't set one.
+const DefaultSearchPath = `"$user", public`
+
 type ForeignKey struct {
+	// Qualified name of the referenced table.
 	ToTable          string
 	ColumnConditions [][2]string
+	// True if the foreign key was declared in a relationships file, and isn't
+	// a real constraint.
+	Declared bool
+	// True if the foreign key was inferred from column names, and isn't a real
+	// constraint.
+	Inferred bool
+	// True if the foreign key should be joined on instead of others between
+	// the same tables, set using "@autojoin prefer".
+	Preferred bool
+	// True if the foreign key was copied to or from a view that passes the
+	// foreign key's columns through, and isn't a real constraint.
+	ViaView bool
 }
 
 type TableInfo struct {
+	Schema  string
 	Name    string
 	Columns []string
 	// Constraint -> Fkey
 	ForeignKeys map[string]*ForeignKey
+	// Columns of the primary key, if the table has one.
+	PrimaryKey []string
+	// Columns of each unique constraint and unique index, other than the
+	// primary key.
+	UniqueKeys [][]string
+	// Columns that can't be null, used to tell if joining on a foreign key can
+	// drop rows.
+	NotNullColumns []string
+	// Qualified names of tables this table inherits columns from using
+	// INHERITS. Partitions aren't included in DatabaseInfo at all.
+	Inherits []string
+	// True if the table should never be joined, set using "@autojoin ignore".
+	Ignored bool
+	// Estimated number of rows from pg_class.reltuples, or 0 if unknown.
+	RowEstimate float64
+	// For views, the view columns that pass through a table column unchanged,
+	// which foreign keys with ViaView are copied using.
+	viewColumns map[string]passthroughColumn
+}
+
+// Returns true if no two rows have the same values for the given columns,
+// because they include the primary key or a unique key.
+func (t *TableInfo) IsUnique(columns []string) bool {
+	for _, key := range append([][]string{t.PrimaryKey}, t.UniqueKeys...) {
+		if len(key) > 0 && !slices.ContainsFunc(key, func(column string) bool {
+			return !slices.Contains(columns, column)
+		}) {
+			return true
+		}
+	}
+	return false
 }
 
+// Tables, ColumnToTable values, and graph vertices are keyed by qualified
+// table name (ex: "billing.invoices").
 type DatabaseInfo struct {
 	Tables            map[string]*TableInfo
 	ColumnToTable     map[string][]string
 	RelationshipGraph graph.Graph[string, string]
 }
 
+// Edges in RelationshipGraph are weighted so that the cheapest path between two
+// tables is the most likely to be the right one to join. Each edge costs
+// baseEdgeWeight, adjusted for the cheapest foreign key between its tables:
+//   - Preferred foreign keys cost 5 less.
+//   - Declared foreign keys cost 2 more, and inferred ones cost 4 more, since
+//     they aren't enforced.
+//   - Nullable foreign keys cost 1 more, since not every row can be joined.
+//   - Large tables cost 1 more per order of magnitude of the larger table's
+//     row estimate.
+const baseEdgeWeight = 10
+
+// A foreign key that an edge in RelationshipGraph can be joined on. The graph
+// can't have more than one edge between two tables, so each edge's data is a
+// list of every foreign key between them.
+type EdgeForeignKey struct {
+	// Qualified name of the table that has the foreign key.
+	Table      string
+	Constraint string
+}
+
+// Returns the name tables are keyed by in DatabaseInfo.
+func QualifiedName(schema, table string) string {
+	return schema + "." + table
+}
+
+// Splits a qualified name into its schema and table name. Unqualified names
+// return an empty schema.
+func SplitQualifiedName(name string) (string, string) {
+	schema, table, ok := strings.Cut(name, ".")
+	if !ok {
+		return "", name
+	}
+	return schema, table
+}
+
+// Parses a search_path setting (ex: `"$user", public`) into a list of schemas.
+func ParseSearchPath(searchPath string, user string) []string {
+	schemas := []string{}
+	for _, part := range strings.Split(searchPath, ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, `"`) && strings.HasSuffix(part, `"`) && len(part) > 1 {
+			part = strings.ReplaceAll(part[1:len(part)-1], `""`, `"`)
+		} else {
+			part = strings.ToLower(part)
+		}
+		if part == "$user" {
+			part = user
+		}
+		if part == "" {
+			continue
+		}
+		schemas = append(schemas, part)
+	}
+	return schemas
+}
+
+// Resolves a possibly unqualified table name to the qualified name of the first
+// matching table on the search path. Returns false if no table matches.
+func (d DatabaseInfo) ResolveTable(name string, searchPath []string) (string, bool) {
+	schema, table := SplitQualifiedName(name)
+	if schema != "" {
+		_, ok := d.Tables[name]
+		return name, ok
+	}
+	for _, schema := range searchPath {
+		qualifiedName := QualifiedName(schema, table)
+		if _, ok := d.Tables[qualifiedName]; ok {
+			return qualifiedName, true
+		}
+	}
+	return name, false
+}
+
 type Queryer interface {
 	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
 }
 
-// Gathers information about every table's column and foreign key.
-func GetDatabaseInfoResult(ctx context.Context, conn Queryer) (DatabaseInfo, error) {
-	rows, err := conn.Query(ctx, columnsWithForeignKeysQuery)
+// Gets the schemas on the connection's search path that actually exist.
+func GetSearchPath(ctx context.Context, conn Queryer) ([]string, error) {
+	rows, err := conn.Query(ctx, searchPathQuery)
 	if err != nil {
-		return DatabaseInfo{}, err
+		return nil, err
 	}
 	defer rows.Close()
 
+	searchPath := []string{}
+	for rows.Next() {
+		err = rows.Scan(&searchPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return searchPath, rows.Err()
+}
+
+// Gathers information about every table's column and foreign key, in every
+// non-system schema.
+func GetDatabaseInfoResult(ctx context.Context, conn Queryer) (DatabaseInfo, error) {
 	tableInfo := map[string]*TableInfo{}
 
+	rows, err := conn.Query(ctx, columnsQuery)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	defer rows.Close()
+
 	for rows.Next() {
-		var fromTableName string
-		var fromColumnName string
-		var toTableName string
-		var toColumnName string // Unused
-		var constaintName string
-		err = rows.Scan(&fromTableName, &fromColumnName, &toTableName, &toColumnName, &constaintName)
+		var schemaName string
+		var tableName string
+		var columnName string
+		var notNull bool
+		var rowEstimate float64
+		err = rows.Scan(&schemaName, &tableName, &columnName, &notNull, &rowEstimate)
 		if err != nil {
 			return DatabaseInfo{}, err
 		}
-		_, tableExists := tableInfo[fromTableName]
+		qualifiedName := QualifiedName(schemaName, tableName)
+		_, tableExists := tableInfo[qualifiedName]
 		if !tableExists {
-			tableInfo[fromTableName] = &TableInfo{
-				Name:        fromTableName,
+			tableInfo[qualifiedName] = &TableInfo{
+				Schema:      schemaName,
+				Name:        tableName,
 				Columns:     []string{},
 				ForeignKeys: map[string]*ForeignKey{},
+				RowEstimate: rowEstimate,
 			}
 		}
-		tableInfo[fromTableName].Columns = append(tableInfo[fromTableName].Columns, fromColumnName)
-		if constaintName != "" {
-			_, fkeyExists := tableInfo[fromTableName].ForeignKeys[constaintName]
-			if !fkeyExists {
-				tableInfo[fromTableName].ForeignKeys[constaintName] = &ForeignKey{
-					ToTable:          toTableName,
-					ColumnConditions: [][2]string{},
-				}
-			}
-			if fromColumnName != "" && toColumnName != "" {
-				tableInfo[fromTableName].ForeignKeys[constaintName].ColumnConditions = append(
-					tableInfo[fromTableName].ForeignKeys[constaintName].ColumnConditions,
-					[2]string{fromColumnName, toColumnName},
-				)
+		tableInfo[qualifiedName].Columns = append(tableInfo[qualifiedName].Columns, columnName)
+		if notNull {
+			tableInfo[qualifiedName].NotNullColumns = append(tableInfo[qualifiedName].NotNullColumns, columnName)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return DatabaseInfo{}, err
+	}
+
+	rows, err = conn.Query(ctx, foreignKeysQuery)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fromSchemaName string
+		var fromTableName string
+		var constaintName string
+		var toSchemaName string
+		var toTableName string
+		var fromColumnName string
+		var toColumnName string
+		err = rows.Scan(&fromSchemaName, &fromTableName, &constaintName, &toSchemaName, &toTableName, &fromColumnName, &toColumnName)
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+		table, tableExists := tableInfo[QualifiedName(fromSchemaName, fromTableName)]
+		if !tableExists {
+			continue
+		}
+		_, fkeyExists := table.ForeignKeys[constaintName]
+		if !fkeyExists {
+			// Foreign keys may reference tables in other schemas.
+			table.ForeignKeys[constaintName] = &ForeignKey{
+				ToTable:          QualifiedName(toSchemaName, toTableName),
+				ColumnConditions: [][2]string{},
 			}
 		}
+		table.ForeignKeys[constaintName].ColumnConditions = append(
+			table.ForeignKeys[constaintName].ColumnConditions,
+			[2]string{fromColumnName, toColumnName},
+		)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return DatabaseInfo{}, err
+	}
+
+	rows, err = conn.Query(ctx, primaryKeysQuery)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schemaName string
+		var tableName string
+		var columnName string
+		err = rows.Scan(&schemaName, &tableName, &columnName)
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+		table, tableExists := tableInfo[QualifiedName(schemaName, tableName)]
+		if !tableExists {
+			continue
+		}
+		table.PrimaryKey = append(table.PrimaryKey, columnName)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return DatabaseInfo{}, err
+	}
+
+	rows, err = conn.Query(ctx, uniqueKeysQuery)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	defer rows.Close()
+
+	lastIndexName := ""
+	for rows.Next() {
+		var schemaName string
+		var tableName string
+		var indexName string
+		var columnName string
+		err = rows.Scan(&schemaName, &tableName, &indexName, &columnName)
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+		table, tableExists := tableInfo[QualifiedName(schemaName, tableName)]
+		if !tableExists {
+			continue
+		}
+		qualifiedIndexName := QualifiedName(schemaName, indexName)
+		if qualifiedIndexName != lastIndexName {
+			table.UniqueKeys = append(table.UniqueKeys, []string{})
+			lastIndexName = qualifiedIndexName
+		}
+		table.UniqueKeys[len(table.UniqueKeys)-1] = append(table.UniqueKeys[len(table.UniqueKeys)-1], columnName)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return DatabaseInfo{}, err
+	}
+
+	// View definitions and comment directives only qualify tables that
+	// aren't on the search path.
+	searchPath, err := GetSearchPath(ctx, conn)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	rows, err = conn.Query(ctx, commentsQuery)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	defer rows.Close()
+
+	comments := []objectComment{}
+	for rows.Next() {
+		var schemaName string
+		var tableName string
+		var comment objectComment
+		err = rows.Scan(&schemaName, &tableName, &comment.Column, &comment.Constraint, &comment.Comment)
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+		table, tableExists := tableInfo[QualifiedName(schemaName, tableName)]
+		if !tableExists {
+			continue
+		}
+		comment.Table = table
+		comments = append(comments, comment)
 	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return DatabaseInfo{}, err
+	}
+	applyCommentDirectives(tableInfo, comments, searchPath)
+
+	rows, err = conn.Query(ctx, inheritsQuery)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schemaName string
+		var tableName string
+		var parentSchemaName string
+		var parentTableName string
+		err = rows.Scan(&schemaName, &tableName, &parentSchemaName, &parentTableName)
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+		table, tableExists := tableInfo[QualifiedName(schemaName, tableName)]
+		if !tableExists {
+			continue
+		}
+		table.Inherits = append(table.Inherits, QualifiedName(parentSchemaName, parentTableName))
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return DatabaseInfo{}, err
+	}
+	addInheritedForeignKeys(tableInfo)
+
+	rows, err = conn.Query(ctx, viewsQuery)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	defer rows.Close()
 
+	for rows.Next() {
+		var schemaName string
+		var viewName string
+		var definition string
+		err = rows.Scan(&schemaName, &viewName, &definition)
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+		parsedDefinition, err := pg_query.Parse(definition)
+		if err != nil || len(parsedDefinition.Stmts) != 1 || parsedDefinition.Stmts[0].Stmt.GetSelectStmt() == nil {
+			slog.Debug("Could not parse view definition", slog.String("view", viewName), slog.Any("error", err))
+			continue
+		}
+		view, ok := tableInfo[QualifiedName(schemaName, viewName)]
+		if !ok {
+			continue
+		}
+		_, passthroughs := analyzeViewQuery(parsedDefinition.Stmts[0].Stmt.GetSelectStmt(), tableInfo, searchPath)
+		if len(passthroughs) > 0 {
+			view.viewColumns = passthroughs
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return DatabaseInfo{}, err
+	}
+	addViewForeignKeys(tableInfo)
+
+	return newDatabaseInfo(tableInfo), nil
+}
+
+// Builds the relationship graph and column map for the given tables.
+func newDatabaseInfo(tableInfo map[string]*TableInfo) DatabaseInfo {
 	// Add all tables to a graph.
-	relationshipGraph := graph.New(graph.StringHash)
+	relationshipGraph := graph.New(graph.StringHash, graph.Weighted())
 	for tableName := range tableInfo {
 		relationshipGraph.AddVertex(tableName) //nolint:all
 	}
+	databaseInfo := DatabaseInfo{tableInfo, nil, relationshipGraph}
 	for tableName, table := range tableInfo {
-		for _, fkey := range table.ForeignKeys {
-			relationshipGraph.AddEdge(tableName, fkey.ToTable) //nolint:all
+		for constraintName := range table.ForeignKeys {
+			databaseInfo.addForeignKeyEdge(tableName, constraintName)
 		}
 	}
 
-	// Create a map of column name to table name for future use.
+	// Create a map of column name to table name for future use. Inherited
+	// columns are only mapped to the parent table, otherwise every column of a
+	// parent would be ambiguous.
 	columnToTable := map[string][]string{}
 	for tableName, table := range tableInfo {
+		if table.Ignored {
+			continue
+		}
 		for _, column := range table.Columns {
+			if isInheritedColumn(tableInfo, table, column) {
+				continue
+			}
 			_, ok := columnToTable[column]
 			if !ok {
 				columnToTable[column] = []string{}
@@ -131,5 +595,119 @@ func GetDatabaseInfoResult(ctx context.Context, conn Queryer) (DatabaseInfo, err
 		}
 	}
 
-	return DatabaseInfo{tableInfo, columnToTable, relationshipGraph}, nil
+	databaseInfo.ColumnToTable = columnToTable
+	return databaseInfo
+}
+
+// Adds a foreign key to the edge between its tables. Ignored tables can't be
+// joined, or joined through, so they don't get edges.
+func (d DatabaseInfo) addForeignKeyEdge(tableName string, constraintName string) {
+	toTableName := d.Tables[tableName].ForeignKeys[constraintName].ToTable
+	toTable, ok := d.Tables[toTableName]
+	if d.Tables[tableName].Ignored || !ok || toTable.Ignored {
+		return
+	}
+	edgeForeignKeys := []EdgeForeignKey{{tableName, constraintName}}
+	edge, err := d.RelationshipGraph.Edge(tableName, toTableName)
+	if err != nil {
+		d.RelationshipGraph.AddEdge(tableName, toTableName, graph.EdgeData(edgeForeignKeys), graph.EdgeWeight(d.edgeWeight(edgeForeignKeys))) //nolint:all
+		return
+	}
+	existingEdgeForeignKeys, _ := edge.Properties.Data.([]EdgeForeignKey)
+	edgeForeignKeys = append(edgeForeignKeys, existingEdgeForeignKeys...)
+	slices.SortFunc(edgeForeignKeys, func(a, b EdgeForeignKey) int {
+		return strings.Compare(a.Table+"."+a.Constraint, b.Table+"."+b.Constraint)
+	})
+	d.RelationshipGraph.UpdateEdge(tableName, toTableName, graph.EdgeData(edgeForeignKeys), graph.EdgeWeight(d.edgeWeight(edgeForeignKeys))) //nolint:all
+}
+
+// Returns the weight of an edge with the given foreign keys, see
+// baseEdgeWeight.
+func (d DatabaseInfo) edgeWeight(edgeForeignKeys []EdgeForeignKey) int {
+	weight := 0
+	for i, edgeForeignKey := range edgeForeignKeys {
+		table := d.Tables[edgeForeignKey.Table]
+		fkey := table.ForeignKeys[edgeForeignKey.Constraint]
+		fkeyWeight := baseEdgeWeight
+		if fkey.Preferred {
+			fkeyWeight -= 5
+		}
+		if fkey.Declared {
+			fkeyWeight += 2
+		} else if fkey.Inferred {
+			fkeyWeight += 4
+		}
+		for _, fromToPair := range fkey.ColumnConditions {
+			if !slices.Contains(table.NotNullColumns, fromToPair[0]) {
+				fkeyWeight++
+				break
+			}
+		}
+		if i == 0 || fkeyWeight < weight {
+			weight = fkeyWeight
+		}
+	}
+	if len(edgeForeignKeys) == 0 {
+		return weight
+	}
+	table := d.Tables[edgeForeignKeys[0].Table]
+	otherTable := d.Tables[table.ForeignKeys[edgeForeignKeys[0].Constraint].ToTable]
+	if rowEstimate := max(table.RowEstimate, otherTable.RowEstimate); rowEstimate >= 1 {
+		weight += int(math.Log10(rowEstimate))
+	}
+	return weight
+}
+
+// Returns the weight of the edge between two tables, or 0 if there isn't one.
+func (d DatabaseInfo) EdgeWeight(tableName string, otherTableName string) int {
+	edge, err := d.RelationshipGraph.Edge(tableName, otherTableName)
+	if err != nil {
+		return 0
+	}
+	return edge.Properties.Weight
+}
+
+// Returns every foreign key between two tables, in either direction.
+func (d DatabaseInfo) ForeignKeysBetween(tableName string, otherTableName string) []EdgeForeignKey {
+	edge, err := d.RelationshipGraph.Edge(tableName, otherTableName)
+	if err != nil {
+		return []EdgeForeignKey{}
+	}
+	edgeForeignKeys, _ := edge.Properties.Data.([]EdgeForeignKey)
+	return slices.Clone(edgeForeignKeys)
+}
+
+// Tables that use INHERITS don't inherit foreign keys in Postgres, but since
+// they have the same columns their parent's foreign keys can be used to join
+// them too. Repeats until grandchildren have their foreign keys.
+func addInheritedForeignKeys(tables map[string]*TableInfo) {
+	for added := true; added; {
+		added = false
+		for _, table := range tables {
+			for _, parentName := range table.Inherits {
+				parent, ok := tables[parentName]
+				if !ok {
+					continue
+				}
+				for constraintName, fkey := range parent.ForeignKeys {
+					if _, ok := table.ForeignKeys[constraintName]; ok {
+						continue
+					}
+					inheritedFkey := *fkey
+					inheritedFkey.ColumnConditions = slices.Clone(fkey.ColumnConditions)
+					table.ForeignKeys[constraintName] = &inheritedFkey
+					added = true
+				}
+			}
+		}
+	}
+}
+
+func isInheritedColumn(tables map[string]*TableInfo, table *TableInfo, column string) bool {
+	for _, parentName := range table.Inherits {
+		if parent, ok := tables[parentName]; ok && !parent.Ignored && slices.Contains(parent.Columns, column) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,356 @@
+package dbinfo
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDatabaseInfoFromMigrations(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromMigrations("testdata/migrations")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"public.accounts", "public.organization_users", "public.organizations"}, slices.Sorted(maps.Keys(databaseInfo.Tables)))
+	require.Equal(t, []string{"id", "login"}, databaseInfo.Tables["public.accounts"].Columns)
+	require.Equal(t, []string{"id", "organization_id", "account_id"}, databaseInfo.Tables["public.organization_users"].Columns)
+	require.Equal(t, map[string]*ForeignKey{
+		"organization_users_account_id_fkey": {
+			ToTable:          "public.accounts",
+			ColumnConditions: [][2]string{{"account_id", "id"}},
+		},
+	}, databaseInfo.Tables["public.organization_users"].ForeignKeys)
+	require.Empty(t, databaseInfo.Tables["public.organizations"].ForeignKeys)
+}
+
+func TestSchemaSource(t *testing.T) {
+	source := SchemaSource{MigrationsDir: "testdata/migrations"}
+	require.Equal(t, "testdata/migrations", source.Path())
+	databaseInfo, err := source.GetDatabaseInfo(context.Background(), nil)
+	require.NoError(t, err)
+	require.Contains(t, databaseInfo.Tables, "public.accounts")
+
+	source.SnapshotFile = "schema.json"
+	require.Error(t, source.Validate())
+	_, err = source.GetDatabaseInfo(context.Background(), nil)
+	require.Error(t, err)
+
+	// The database is used if no other source is set.
+	require.Equal(t, "", SchemaSource{}.Path())
+	_, err = SchemaSource{}.GetDatabaseInfo(context.Background(), nil)
+	require.Error(t, err)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromMigrations("testdata/migrations")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = Save(&buf, databaseInfo)
+	require.NoError(t, err)
+	loadedDatabaseInfo, err := Load(&buf)
+	require.NoError(t, err)
+
+	require.Equal(t, databaseInfo.Tables, loadedDatabaseInfo.Tables)
+	_, err = loadedDatabaseInfo.RelationshipGraph.Edge("public.organization_users", "public.accounts")
+	require.NoError(t, err)
+
+	_, err = Load(strings.NewReader(`{"version": 1000, "tables": []}`))
+	require.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	from, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE users (id INT PRIMARY KEY, email TEXT, legacy_id INT);
+		CREATE TABLE avatars (id INT PRIMARY KEY, user_id INT REFERENCES users(id));
+	`)
+	require.NoError(t, err)
+	to, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE users (id INT PRIMARY KEY, email TEXT);
+		CREATE TABLE accounts (id INT PRIMARY KEY, email TEXT);
+		CREATE TABLE avatars (id INT PRIMARY KEY, user_id INT REFERENCES accounts(id));
+	`)
+	require.NoError(t, err)
+
+	require.Equal(t, SchemaDiff{
+		AddedTables:              []string{"public.accounts"},
+		RemovedTables:            []string{},
+		AddedColumns:             []string{},
+		RemovedColumns:           []string{"public.users.legacy_id"},
+		AddedForeignKeys:         []string{"public.avatars.avatars_user_id_fkey (user_id) -> public.accounts (id)"},
+		RemovedForeignKeys:       []string{"public.avatars.avatars_user_id_fkey (user_id) -> public.users (id)"},
+		NewlyAmbiguousColumns:    []string{"email"},
+		NoLongerAmbiguousColumns: []string{},
+	}, Diff(from, to))
+	require.True(t, Diff(to, to).IsEmpty())
+}
+
+func TestViewForeignKeys(t *testing.T) {
+	ddl := `
+		CREATE TABLE users (id INT PRIMARY KEY, email TEXT);
+		CREATE TABLE notes (id INT PRIMARY KEY, user_id INT REFERENCES users(id));
+		CREATE VIEW active_users AS SELECT id, email FROM users;
+	`
+	databaseInfo, err := GetDatabaseInfoFromDDL(ddl)
+	require.NoError(t, err)
+	require.Equal(t, &ForeignKey{
+		ToTable:          "public.active_users",
+		ColumnConditions: [][2]string{{"user_id", "id"}},
+		ViaView:          true,
+	}, databaseInfo.Tables["public.notes"].ForeignKeys["notes_user_id_fkey_via_active_users"])
+
+	// Foreign keys copied for views aren't saved, but are copied again when
+	// loading the snapshot.
+	var buf bytes.Buffer
+	require.NoError(t, Save(&buf, databaseInfo))
+	require.NotContains(t, buf.String(), "_via_")
+	loadedDatabaseInfo, err := Load(&buf)
+	require.NoError(t, err)
+	require.Equal(t, databaseInfo.Tables, loadedDatabaseInfo.Tables)
+
+	// Foreign keys copied for views aren't schema changes of their own.
+	withoutView, err := GetDatabaseInfoFromDDL(ddl + "DROP VIEW active_users;")
+	require.NoError(t, err)
+	require.Equal(t, []string{"public.active_users"}, Diff(withoutView, databaseInfo).AddedTables)
+	require.Empty(t, Diff(withoutView, databaseInfo).AddedForeignKeys)
+}
+
+func TestPartitionsFromDDL(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE users (id INT PRIMARY KEY);
+		CREATE TABLE events (id INT, user_id INT, created_at TIMESTAMP) PARTITION BY RANGE (created_at);
+		CREATE TABLE events_2026_01 PARTITION OF events FOR VALUES FROM ('2026-01-01') TO ('2026-02-01');
+		CREATE TABLE events_2026_02 (id INT, user_id INT, created_at TIMESTAMP);
+		ALTER TABLE events ATTACH PARTITION events_2026_02 FOR VALUES FROM ('2026-02-01') TO ('2026-03-01');
+		ALTER TABLE events_2026_01 ADD CONSTRAINT events_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+		CREATE TABLE event_tags (event_id INT, tag TEXT, FOREIGN KEY (event_id) REFERENCES events_2026_02 (id));
+		CREATE TABLE events_2025 (id INT, user_id INT, created_at TIMESTAMP);
+		ALTER TABLE events ATTACH PARTITION events_2025 FOR VALUES FROM ('2025-01-01') TO ('2026-01-01');
+		ALTER TABLE events DETACH PARTITION events_2025;
+	`)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"public.event_tags", "public.events", "public.events_2025", "public.users"}, slices.Sorted(maps.Keys(databaseInfo.Tables)))
+	require.Equal(t, "public.users", databaseInfo.Tables["public.events"].ForeignKeys["events_user_id_fkey"].ToTable)
+	require.Equal(t, "public.events", databaseInfo.Tables["public.event_tags"].ForeignKeys["event_tags_event_id_fkey"].ToTable)
+	require.Equal(t, "public.users", databaseInfo.Tables["public.events_2025"].ForeignKeys["events_user_id_fkey"].ToTable)
+	require.ElementsMatch(t, []string{"public.events", "public.events_2025"}, databaseInfo.ColumnToTable["created_at"])
+}
+
+func TestInheritsFromDDL(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE users (id INT PRIMARY KEY);
+		CREATE TABLE notes (id INT PRIMARY KEY, user_id INT REFERENCES users(id), body TEXT);
+		CREATE TABLE pinned_notes (body TEXT, pinned_at TIMESTAMP) INHERITS (notes);
+		ALTER TABLE notes ADD COLUMN title TEXT;
+		ALTER TABLE notes RENAME COLUMN body TO contents;
+	`)
+	require.NoError(t, err)
+
+	pinnedNotes := databaseInfo.Tables["public.pinned_notes"]
+	require.Equal(t, []string{"id", "user_id", "contents", "pinned_at", "title"}, pinnedNotes.Columns)
+	require.Equal(t, []string{"public.notes"}, pinnedNotes.Inherits)
+	require.Equal(t, "public.users", pinnedNotes.ForeignKeys["notes_user_id_fkey"].ToTable)
+	require.Equal(t, []string{"public.notes"}, databaseInfo.ColumnToTable["contents"])
+	require.Equal(t, []string{"public.pinned_notes"}, databaseInfo.ColumnToTable["pinned_at"])
+
+	// Inherited foreign keys keep how they were found.
+	databaseInfo, err = GetDatabaseInfoFromDDL(`
+		CREATE TABLE users (id INT PRIMARY KEY);
+		CREATE TABLE notes (id INT PRIMARY KEY, author_id INT);
+		COMMENT ON COLUMN notes.author_id IS '@autojoin references users';
+		CREATE TABLE pinned_notes (pinned_at TIMESTAMP) INHERITS (notes);
+	`)
+	require.NoError(t, err)
+	require.Equal(t, databaseInfo.Tables["public.notes"].ForeignKeys, databaseInfo.Tables["public.pinned_notes"].ForeignKeys)
+	require.True(t, databaseInfo.Tables["public.pinned_notes"].ForeignKeys["notes_author_id_declared"].Declared)
+
+	databaseInfo, err = GetDatabaseInfoFromDDL(`
+		CREATE TABLE notes (id INT PRIMARY KEY);
+		CREATE TABLE pinned_notes (pinned_at TIMESTAMP) INHERITS (notes);
+		DROP TABLE notes CASCADE;
+	`)
+	require.NoError(t, err)
+	require.Empty(t, databaseInfo.Tables)
+}
+
+func TestAddRelationships(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE customers (id INT PRIMARY KEY, external_id TEXT);
+		CREATE TABLE orders (id INT PRIMARY KEY, customer_ref TEXT);
+	`)
+	require.NoError(t, err)
+	relationships, err := LoadRelationships(strings.NewReader(`{"foreign_keys": ["orders.customer_ref -> customers.external_id"]}`))
+	require.NoError(t, err)
+	require.NoError(t, databaseInfo.AddRelationships(relationships))
+
+	require.Equal(t, &ForeignKey{
+		ToTable:          "public.customers",
+		ColumnConditions: [][2]string{{"customer_ref", "external_id"}},
+		Declared:         true,
+	}, databaseInfo.Tables["public.orders"].ForeignKeys["orders_customer_ref_declared"])
+	_, err = databaseInfo.RelationshipGraph.Edge("public.orders", "public.customers")
+	require.NoError(t, err)
+
+	// Relationships that are already foreign keys aren't added again, ex: when
+	// a snapshot was saved with the same relationships.
+	var buf bytes.Buffer
+	require.NoError(t, Save(&buf, databaseInfo))
+	loadedDatabaseInfo, err := Load(&buf)
+	require.NoError(t, err)
+	require.NoError(t, loadedDatabaseInfo.AddRelationships(relationships))
+	require.NoError(t, loadedDatabaseInfo.AddRelationships(relationships))
+	require.Equal(t, databaseInfo.Tables, loadedDatabaseInfo.Tables)
+
+	for _, declaration := range []string{
+		"orders.customer_ref customers.external_id",
+		"orders.missing -> customers.external_id",
+		"missing.customer_ref -> customers.external_id",
+		"orders(id, customer_ref) -> customers(external_id)",
+	} {
+		err = databaseInfo.AddRelationships(Relationships{ForeignKeys: []string{declaration}})
+		require.Error(t, err, declaration)
+	}
+}
+
+func TestInferForeignKeys(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE categories (id INT PRIMARY KEY);
+		CREATE TABLE boxes (id INT PRIMARY KEY);
+		CREATE TABLE keys (name TEXT, version INT, PRIMARY KEY (name, version));
+		CREATE TABLE items (
+			id INT PRIMARY KEY,
+			category_id INT,
+			box_id INT REFERENCES categories(id),
+			key_id INT,
+			item_id INT
+		);
+	`)
+	require.NoError(t, err)
+	databaseInfo.InferForeignKeys(InferenceRules{})
+
+	items := databaseInfo.Tables["public.items"]
+	require.Equal(t, []string{"items_box_id_fkey", "items_category_id_inferred"}, slices.Sorted(maps.Keys(items.ForeignKeys)))
+	require.Equal(t, &ForeignKey{
+		ToTable:          "public.categories",
+		ColumnConditions: [][2]string{{"category_id", "id"}},
+		Inferred:         true,
+	}, items.ForeignKeys["items_category_id_inferred"])
+
+	require.Equal(t, "boxes", pluralize("box", nil))
+	require.Equal(t, "categories", pluralize("category", nil))
+	require.Equal(t, "keys", pluralize("key", nil))
+	require.Equal(t, "people", pluralize("person", map[string]string{"person": "people"}))
+}
+
+func TestCommentDirectivesFromDDL(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE orders (id INT PRIMARY KEY, customer_id INT, note TEXT);
+		COMMENT ON COLUMN orders.customer_id IS '@autojoin references customers';
+		COMMENT ON COLUMN orders.note IS '@autojoin references nowhere(id)';
+		COMMENT ON TABLE orders IS '@autojoin ignore';
+		COMMENT ON TABLE orders IS NULL;
+		ALTER TABLE orders RENAME TO purchases;
+		CREATE TABLE customers (id INT PRIMARY KEY);
+	`)
+	require.NoError(t, err)
+
+	purchases := databaseInfo.Tables["public.purchases"]
+	require.False(t, purchases.Ignored)
+	require.Equal(t, map[string]*ForeignKey{
+		"purchases_customer_id_declared": {
+			ToTable:          "public.customers",
+			ColumnConditions: [][2]string{{"customer_id", "id"}},
+			Declared:         true,
+		},
+	}, purchases.ForeignKeys)
+}
+
+func TestForeignKeysBetween(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE users (id INT PRIMARY KEY);
+		CREATE TABLE messages (
+			id INT PRIMARY KEY,
+			sender_id INT REFERENCES users(id),
+			recipient_id INT REFERENCES users(id)
+		);
+	`)
+	require.NoError(t, err)
+
+	expected := []EdgeForeignKey{
+		{Table: "public.messages", Constraint: "messages_recipient_id_fkey"},
+		{Table: "public.messages", Constraint: "messages_sender_id_fkey"},
+	}
+	require.Equal(t, expected, databaseInfo.ForeignKeysBetween("public.messages", "public.users"))
+	require.Equal(t, expected, databaseInfo.ForeignKeysBetween("public.users", "public.messages"))
+	require.Empty(t, databaseInfo.ForeignKeysBetween("public.users", "public.missing"))
+}
+
+func TestNotNullColumnsFromDDL(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE users (id INT, email TEXT NOT NULL, name TEXT, PRIMARY KEY (id));
+		CREATE TABLE admins (level INT) INHERITS (users);
+		ALTER TABLE users ALTER COLUMN name SET NOT NULL, ALTER COLUMN email DROP NOT NULL;
+		ALTER TABLE users RENAME COLUMN name TO full_name;
+		ALTER TABLE admins ADD COLUMN team_id INT NOT NULL;
+	`)
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, []string{"id", "full_name"}, databaseInfo.Tables["public.users"].NotNullColumns)
+	require.ElementsMatch(t, []string{"id", "full_name", "team_id"}, databaseInfo.Tables["public.admins"].NotNullColumns)
+}
+
+func TestUniqueKeysFromDDL(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE users (id INT PRIMARY KEY, email TEXT UNIQUE, handle TEXT, org_id INT, external_id TEXT);
+		ALTER TABLE users ADD CONSTRAINT users_org_handle_key UNIQUE (org_id, handle);
+		CREATE UNIQUE INDEX users_external_id_idx ON users (external_id);
+		CREATE UNIQUE INDEX users_lower_email_idx ON users (lower(email));
+		CREATE UNIQUE INDEX users_active_handle_idx ON users (handle) WHERE org_id IS NULL;
+		ALTER INDEX users_external_id_idx RENAME TO users_ext_idx;
+		DROP INDEX users_ext_idx;
+		ALTER TABLE users RENAME COLUMN handle TO username;
+	`)
+	require.NoError(t, err)
+
+	users := databaseInfo.Tables["public.users"]
+	require.Equal(t, [][]string{{"email"}, {"org_id", "username"}}, users.UniqueKeys)
+	require.True(t, users.IsUnique([]string{"id"}))
+	require.True(t, users.IsUnique([]string{"username", "org_id"}))
+	require.False(t, users.IsUnique([]string{"username"}))
+	require.False(t, users.IsUnique([]string{"external_id"}))
+}
+
+func TestEdgeWeight(t *testing.T) {
+	databaseInfo, err := GetDatabaseInfoFromDDL(`
+		CREATE TABLE users (id INT PRIMARY KEY, external_id TEXT);
+		CREATE TABLE avatars (id INT PRIMARY KEY, user_id INT NOT NULL REFERENCES users(id));
+		CREATE TABLE posts (id INT PRIMARY KEY, author_id INT REFERENCES users(id));
+		CREATE TABLE addresses (id INT PRIMARY KEY, user_id INT REFERENCES users(id));
+		CREATE TABLE orders (id INT PRIMARY KEY, user_ref TEXT NOT NULL);
+		COMMENT ON CONSTRAINT addresses_user_id_fkey ON addresses IS '@autojoin prefer';
+	`)
+	require.NoError(t, err)
+	err = databaseInfo.AddRelationships(Relationships{ForeignKeys: []string{"orders.user_ref -> users.external_id"}})
+	require.NoError(t, err)
+
+	require.Equal(t, 10, databaseInfo.EdgeWeight("public.avatars", "public.users"))
+	require.Equal(t, 11, databaseInfo.EdgeWeight("public.users", "public.posts"))
+	require.Equal(t, 6, databaseInfo.EdgeWeight("public.addresses", "public.users"))
+	require.Equal(t, 12, databaseInfo.EdgeWeight("public.orders", "public.users"))
+	require.Equal(t, 0, databaseInfo.EdgeWeight("public.orders", "public.posts"))
+
+	// Row estimates come from the database, or snapshots of it.
+	databaseInfo, err = Load(strings.NewReader(`{"version": 1, "tables": [
+		{"schema": "public", "name": "users", "columns": ["id"], "foreign_keys": [], "row_estimate": 50000},
+		{"schema": "public", "name": "avatars", "columns": ["id", "user_id"], "foreign_keys": [
+			{"name": "avatars_user_id_fkey", "to_table": "public.users", "column_conditions": [["user_id", "id"]]}
+		], "not_null": ["user_id"], "row_estimate": 120}
+	]}`))
+	require.NoError(t, err)
+	require.Equal(t, 14, databaseInfo.EdgeWeight("public.avatars", "public.users"))
+}
@@ -0,0 +1,962 @@
+package dbinfo
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// Postgres truncates identifiers to NAMEDATALEN - 1 bytes.
+const maxIdentifierLength = 63
+
+// Builds up tables from DDL statements, mimicking what Postgres would have in
+// its catalog after running them.
+type schemaBuilder struct {
+	tables map[string]*TableInfo
+	// Qualified table name -> primary key.
+	primaryKeys map[string]keyConstraint
+	// Qualified table name -> unique constraints and unique indexes.
+	uniqueKeys map[string][]keyConstraint
+	// Qualified partition name -> the table it's a partition of. Partitions
+	// aren't in tables, since they're collapsed into their partitioned table.
+	partitions map[string]string
+	// Comments are applied last, since they can reference tables created later.
+	comments   []objectComment
+	searchPath []string
+}
+
+// A primary key, unique constraint, or unique index.
+type keyConstraint struct {
+	Name    string
+	Columns []string
+}
+
+// Column constraints don't list their column, so it's tracked separately.
+type columnConstraint struct {
+	constraint *pg_query.Constraint
+	columns    []string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{
+		tables:      map[string]*TableInfo{},
+		primaryKeys: map[string]keyConstraint{},
+		uniqueKeys:  map[string][]keyConstraint{},
+		partitions:  map[string]string{},
+		searchPath:  ParseSearchPath(DefaultSearchPath, ""),
+	}
+}
+
+// Gathers information about every table's column and foreign key from DDL
+// (ex: a schema.sql file or pg_dump --schema-only output) instead of a live
+// database. Only statements that affect tables are applied, others are ignored.
+func GetDatabaseInfoFromDDL(ddl string) (DatabaseInfo, error) {
+	builder := newSchemaBuilder()
+	err := builder.apply(ddl)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	return builder.databaseInfo(), nil
+}
+
+// Views and inheriting tables are given foreign keys last, since foreign keys
+// are often added after tables are created (ex: in pg_dump output).
+func (b *schemaBuilder) databaseInfo() DatabaseInfo {
+	for tableName, pkey := range b.primaryKeys {
+		if table, ok := b.tables[tableName]; ok {
+			table.PrimaryKey = slices.Clone(pkey.Columns)
+		}
+	}
+	for tableName, uniqueKeys := range b.uniqueKeys {
+		if table, ok := b.tables[tableName]; ok {
+			for _, uniqueKey := range uniqueKeys {
+				table.UniqueKeys = append(table.UniqueKeys, slices.Clone(uniqueKey.Columns))
+			}
+		}
+	}
+	comments := []objectComment{}
+	for _, comment := range b.comments {
+		// Skip comments on tables that were dropped.
+		if b.tables[QualifiedName(comment.Table.Schema, comment.Table.Name)] == comment.Table {
+			comments = append(comments, comment)
+		}
+	}
+	applyCommentDirectives(b.tables, comments, b.searchPath)
+	addInheritedForeignKeys(b.tables)
+	addViewForeignKeys(b.tables)
+	return newDatabaseInfo(b.tables)
+}
+
+func (b *schemaBuilder) apply(ddl string) error {
+	parsedDDL, err := pg_query.Parse(ddl)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range parsedDDL.GetStmts() {
+		switch {
+		case stmt.Stmt.GetCreateStmt() != nil:
+			err = b.createTable(stmt.Stmt.GetCreateStmt())
+		case stmt.Stmt.GetViewStmt() != nil:
+			viewStmt := stmt.Stmt.GetViewStmt()
+			err = b.createView(viewStmt.View, viewStmt.Aliases, viewStmt.Query, viewStmt.Replace)
+		case stmt.Stmt.GetCreateTableAsStmt() != nil:
+			createTableAsStmt := stmt.Stmt.GetCreateTableAsStmt()
+			_, exists := b.tables[b.createdName(createTableAsStmt.Into.Rel)]
+			if createTableAsStmt.Objtype == pg_query.ObjectType_OBJECT_MATVIEW && !(exists && createTableAsStmt.IfNotExists) {
+				err = b.createView(createTableAsStmt.Into.Rel, createTableAsStmt.Into.ColNames, createTableAsStmt.Query, false)
+			}
+		case stmt.Stmt.GetIndexStmt() != nil:
+			err = b.createIndex(stmt.Stmt.GetIndexStmt())
+		case stmt.Stmt.GetAlterTableStmt() != nil:
+			err = b.alterTable(stmt.Stmt.GetAlterTableStmt())
+		case stmt.Stmt.GetRenameStmt() != nil:
+			err = b.rename(stmt.Stmt.GetRenameStmt())
+		case stmt.Stmt.GetDropStmt() != nil:
+			err = b.dropTables(stmt.Stmt.GetDropStmt())
+		case stmt.Stmt.GetCommentStmt() != nil:
+			err = b.comment(stmt.Stmt.GetCommentStmt())
+		case stmt.Stmt.GetVariableSetStmt() != nil:
+			b.setSearchPath(stmt.Stmt.GetVariableSetStmt())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the qualified name a table would be created with.
+func (b *schemaBuilder) createdName(relation *pg_query.RangeVar) string {
+	if relation.Schemaname != "" {
+		return QualifiedName(relation.Schemaname, relation.Relname)
+	}
+	if len(b.searchPath) == 0 {
+		return QualifiedName("public", relation.Relname)
+	}
+	return QualifiedName(b.searchPath[0], relation.Relname)
+}
+
+// Returns the qualified name of an existing table (or partition), falling back
+// to the name it would be created with if it doesn't exist.
+func (b *schemaBuilder) resolvedName(relation *pg_query.RangeVar) string {
+	if relation.Schemaname == "" {
+		for _, schema := range b.searchPath {
+			qualifiedName := QualifiedName(schema, relation.Relname)
+			if _, ok := b.tables[qualifiedName]; ok {
+				return qualifiedName
+			}
+			if _, ok := b.partitions[qualifiedName]; ok {
+				return qualifiedName
+			}
+		}
+	}
+	return b.createdName(relation)
+}
+
+// Returns the partitioned table at the top of a partition's tree, or the table
+// itself if it isn't a partition.
+func (b *schemaBuilder) rootTable(tableName string) string {
+	for {
+		parentName, ok := b.partitions[tableName]
+		if !ok {
+			return tableName
+		}
+		tableName = parentName
+	}
+}
+
+// Returns tables that directly inherit from the given table using INHERITS.
+func (b *schemaBuilder) inheritingTables(tableName string) []string {
+	tableNames := []string{}
+	for otherTableName, otherTable := range b.tables {
+		if slices.Contains(otherTable.Inherits, tableName) {
+			tableNames = append(tableNames, otherTableName)
+		}
+	}
+	slices.Sort(tableNames)
+	return tableNames
+}
+
+func (b *schemaBuilder) setSearchPath(stmt *pg_query.VariableSetStmt) {
+	if stmt.Name != "search_path" {
+		return
+	}
+	if stmt.Kind == pg_query.VariableSetKind_VAR_SET_DEFAULT || stmt.Kind == pg_query.VariableSetKind_VAR_RESET {
+		b.searchPath = ParseSearchPath(DefaultSearchPath, "")
+		return
+	}
+	searchPath := []string{}
+	for _, arg := range stmt.Args {
+		if arg.GetAConst() == nil || arg.GetAConst().GetSval() == nil {
+			continue
+		}
+		if schema := arg.GetAConst().GetSval().Sval; schema != "" {
+			searchPath = append(searchPath, schema)
+		}
+	}
+	b.searchPath = searchPath
+}
+
+func (b *schemaBuilder) createTable(stmt *pg_query.CreateStmt) error {
+	tableName := b.createdName(stmt.Relation)
+	_, isTable := b.tables[tableName]
+	_, isPartition := b.partitions[tableName]
+	if isTable || isPartition {
+		if stmt.IfNotExists {
+			return nil
+		}
+		return fmt.Errorf("table %s already exists", tableName)
+	}
+	if stmt.Partbound != nil {
+		return b.createPartition(tableName, stmt)
+	}
+	schema, name := SplitQualifiedName(tableName)
+	table := &TableInfo{
+		Schema:      schema,
+		Name:        name,
+		Columns:     []string{},
+		ForeignKeys: map[string]*ForeignKey{},
+	}
+	// Inherited columns come first, and can be declared again.
+	for _, node := range stmt.InhRelations {
+		parentName := b.resolvedName(node.GetRangeVar())
+		parent, ok := b.tables[parentName]
+		if !ok {
+			return fmt.Errorf("table %s does not exist", parentName)
+		}
+		for _, column := range parent.Columns {
+			if !slices.Contains(table.Columns, column) {
+				table.Columns = append(table.Columns, column)
+			}
+		}
+		for _, column := range parent.NotNullColumns {
+			if !slices.Contains(table.NotNullColumns, column) {
+				table.NotNullColumns = append(table.NotNullColumns, column)
+			}
+		}
+		table.Inherits = append(table.Inherits, parentName)
+	}
+	b.tables[tableName] = table
+
+	constraints := []columnConstraint{}
+	for _, elt := range stmt.TableElts {
+		if columnDef := elt.GetColumnDef(); columnDef != nil {
+			constraints = append(constraints, b.addColumn(tableName, columnDef)...)
+		} else if constraint := elt.GetConstraint(); constraint != nil {
+			constraints = append(constraints, columnConstraint{constraint, nil})
+		}
+	}
+	return b.addConstraints(tableName, constraints)
+}
+
+// Partitions are collapsed into the table they're a partition of, so only
+// their foreign keys are kept.
+func (b *schemaBuilder) createPartition(tableName string, stmt *pg_query.CreateStmt) error {
+	parentName := b.resolvedName(stmt.InhRelations[0].GetRangeVar())
+	rootName := b.rootTable(parentName)
+	if _, ok := b.tables[rootName]; !ok {
+		return fmt.Errorf("table %s does not exist", parentName)
+	}
+	b.partitions[tableName] = parentName
+
+	constraints := []columnConstraint{}
+	for _, elt := range stmt.TableElts {
+		if columnDef := elt.GetColumnDef(); columnDef != nil {
+			for _, node := range columnDef.Constraints {
+				constraints = append(constraints, columnConstraint{node.GetConstraint(), []string{columnDef.Colname}})
+			}
+		} else if constraint := elt.GetConstraint(); constraint != nil {
+			constraints = append(constraints, columnConstraint{constraint, nil})
+		}
+	}
+	return b.addConstraints(rootName, foreignKeyConstraints(constraints))
+}
+
+func foreignKeyConstraints(constraints []columnConstraint) []columnConstraint {
+	return slices.DeleteFunc(constraints, func(c columnConstraint) bool {
+		return c.constraint.Contype != pg_query.ConstrType_CONSTR_FOREIGN
+	})
+}
+
+// Views (and materialized views) are added as tables, with columns named the
+// way Postgres would name them.
+func (b *schemaBuilder) createView(relation *pg_query.RangeVar, aliases []*pg_query.Node, query *pg_query.Node, replace bool) error {
+	viewName := b.createdName(relation)
+	if _, ok := b.tables[viewName]; ok && !replace {
+		return fmt.Errorf("view %s already exists", viewName)
+	}
+	if query.GetSelectStmt() == nil {
+		return nil
+	}
+	columns, passthroughs := analyzeViewQuery(query.GetSelectStmt(), b.tables, b.searchPath)
+	for i, alias := range stringValues(aliases) {
+		if i >= len(columns) {
+			break
+		}
+		if passthrough, ok := passthroughs[columns[i]]; ok {
+			delete(passthroughs, columns[i])
+			passthroughs[alias] = passthrough
+		}
+		columns[i] = alias
+	}
+	schema, name := SplitQualifiedName(viewName)
+	b.tables[viewName] = &TableInfo{
+		Schema:      schema,
+		Name:        name,
+		Columns:     columns,
+		ForeignKeys: map[string]*ForeignKey{},
+	}
+	if len(passthroughs) > 0 {
+		b.tables[viewName].viewColumns = passthroughs
+	}
+	return nil
+}
+
+// Adds a column and returns its constraints, which should be added once all
+// other columns exist. Columns are added to inheriting tables as well.
+func (b *schemaBuilder) addColumn(tableName string, columnDef *pg_query.ColumnDef) []columnConstraint {
+	if !slices.Contains(b.tables[tableName].Columns, columnDef.Colname) {
+		b.tables[tableName].Columns = append(b.tables[tableName].Columns, columnDef.Colname)
+	}
+	for _, childName := range b.inheritingTables(tableName) {
+		b.addColumn(childName, &pg_query.ColumnDef{Colname: columnDef.Colname})
+	}
+	constraints := []columnConstraint{}
+	for _, node := range columnDef.Constraints {
+		constraints = append(constraints, columnConstraint{node.GetConstraint(), []string{columnDef.Colname}})
+	}
+	return constraints
+}
+
+// Foreign keys are added last so that they can reference this table's primary
+// key.
+func (b *schemaBuilder) addConstraints(tableName string, constraints []columnConstraint) error {
+	for _, c := range constraints {
+		if c.constraint.Contype == pg_query.ConstrType_CONSTR_PRIMARY {
+			b.addPrimaryKey(tableName, c.constraint, c.columns)
+		}
+		if c.constraint.Contype == pg_query.ConstrType_CONSTR_UNIQUE {
+			b.addUniqueKey(tableName, c.constraint, c.columns)
+		}
+		if c.constraint.Contype == pg_query.ConstrType_CONSTR_NOTNULL {
+			for _, column := range c.columns {
+				b.setNotNull(tableName, column, true)
+			}
+		}
+	}
+	for _, c := range constraints {
+		if c.constraint.Contype == pg_query.ConstrType_CONSTR_FOREIGN {
+			err := b.addForeignKey(tableName, c.constraint, c.columns)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *schemaBuilder) alterTable(stmt *pg_query.AlterTableStmt) error {
+	// ALTER INDEX, ALTER SEQUENCE, etc. are also AlterTableStmts.
+	if stmt.Objtype != pg_query.ObjectType_OBJECT_TABLE {
+		return nil
+	}
+	tableName := b.resolvedName(stmt.Relation)
+	if _, ok := b.partitions[tableName]; ok {
+		return b.alterPartition(tableName, stmt)
+	}
+	table, ok := b.tables[tableName]
+	if !ok {
+		if stmt.MissingOk {
+			return nil
+		}
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	for _, node := range stmt.Cmds {
+		cmd := node.GetAlterTableCmd()
+		if cmd == nil {
+			continue
+		}
+		var err error
+		switch cmd.Subtype {
+		case pg_query.AlterTableType_AT_AddColumn:
+			columnDef := cmd.Def.GetColumnDef()
+			if slices.Contains(table.Columns, columnDef.Colname) {
+				if cmd.MissingOk {
+					continue
+				}
+				return fmt.Errorf("column %s of table %s already exists", columnDef.Colname, tableName)
+			}
+			err = b.addConstraints(tableName, b.addColumn(tableName, columnDef))
+		case pg_query.AlterTableType_AT_DropColumn:
+			if !slices.Contains(table.Columns, cmd.Name) {
+				if cmd.MissingOk {
+					continue
+				}
+				return fmt.Errorf("column %s of table %s does not exist", cmd.Name, tableName)
+			}
+			b.dropColumn(tableName, cmd.Name)
+		case pg_query.AlterTableType_AT_AddConstraint:
+			err = b.addConstraints(tableName, []columnConstraint{{cmd.Def.GetConstraint(), nil}})
+		case pg_query.AlterTableType_AT_DropConstraint:
+			_, isForeignKey := table.ForeignKeys[cmd.Name]
+			isPrimaryKey := b.primaryKeys[tableName].Name == cmd.Name
+			isUniqueKey := slices.ContainsFunc(b.uniqueKeys[tableName], func(uniqueKey keyConstraint) bool {
+				return uniqueKey.Name == cmd.Name
+			})
+			if !isForeignKey && !isPrimaryKey && !isUniqueKey {
+				// Other constraints (CHECK, EXCLUDE, etc.) aren't tracked.
+				continue
+			}
+			delete(table.ForeignKeys, cmd.Name)
+			if isPrimaryKey {
+				delete(b.primaryKeys, tableName)
+			}
+			b.dropUniqueKeys(tableName, func(uniqueKey keyConstraint) bool {
+				return uniqueKey.Name == cmd.Name
+			})
+		case pg_query.AlterTableType_AT_SetNotNull, pg_query.AlterTableType_AT_DropNotNull:
+			if !slices.Contains(table.Columns, cmd.Name) {
+				return fmt.Errorf("column %s of table %s does not exist", cmd.Name, tableName)
+			}
+			b.setNotNull(tableName, cmd.Name, cmd.Subtype == pg_query.AlterTableType_AT_SetNotNull)
+		case pg_query.AlterTableType_AT_AddInherit:
+			parentName := b.resolvedName(cmd.Def.GetRangeVar())
+			if _, ok := b.tables[parentName]; !ok {
+				return fmt.Errorf("table %s does not exist", parentName)
+			}
+			if !slices.Contains(table.Inherits, parentName) {
+				table.Inherits = append(table.Inherits, parentName)
+			}
+		case pg_query.AlterTableType_AT_DropInherit:
+			parentName := b.resolvedName(cmd.Def.GetRangeVar())
+			table.Inherits = slices.DeleteFunc(table.Inherits, func(name string) bool {
+				return name == parentName
+			})
+		case pg_query.AlterTableType_AT_AttachPartition:
+			err = b.attachPartition(tableName, cmd.Def.GetPartitionCmd().Name)
+		case pg_query.AlterTableType_AT_DetachPartition:
+			err = b.detachPartition(tableName, cmd.Def.GetPartitionCmd().Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Partitions don't have their own columns, but foreign keys added to them
+// still apply to their partitioned table.
+func (b *schemaBuilder) alterPartition(tableName string, stmt *pg_query.AlterTableStmt) error {
+	for _, node := range stmt.Cmds {
+		cmd := node.GetAlterTableCmd()
+		if cmd == nil || cmd.Subtype != pg_query.AlterTableType_AT_AddConstraint {
+			continue
+		}
+		err := b.addConstraints(b.rootTable(tableName), foreignKeyConstraints([]columnConstraint{{cmd.Def.GetConstraint(), nil}}))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Attaching a table as a partition collapses it into its partitioned table,
+// keeping its foreign keys and moving foreign keys that reference it.
+func (b *schemaBuilder) attachPartition(parentName string, relation *pg_query.RangeVar) error {
+	partitionName := b.resolvedName(relation)
+	partition, ok := b.tables[partitionName]
+	if !ok {
+		return fmt.Errorf("table %s does not exist", partitionName)
+	}
+	rootName := b.rootTable(parentName)
+	root := b.tables[rootName]
+	for constraintName, fkey := range partition.ForeignKeys {
+		if _, ok := root.ForeignKeys[constraintName]; !ok {
+			root.ForeignKeys[constraintName] = fkey
+		}
+	}
+	delete(b.tables, partitionName)
+	delete(b.primaryKeys, partitionName)
+	delete(b.uniqueKeys, partitionName)
+	b.partitions[partitionName] = parentName
+	for _, otherTable := range b.tables {
+		for _, fkey := range otherTable.ForeignKeys {
+			if fkey.ToTable == partitionName {
+				fkey.ToTable = rootName
+			}
+		}
+	}
+	return nil
+}
+
+// Detached partitions become tables again, with the columns and foreign keys
+// of their partitioned table.
+func (b *schemaBuilder) detachPartition(parentName string, relation *pg_query.RangeVar) error {
+	partitionName := b.resolvedName(relation)
+	if b.partitions[partitionName] != parentName {
+		return fmt.Errorf("%s is not a partition of %s", partitionName, parentName)
+	}
+	root := b.tables[b.rootTable(parentName)]
+	delete(b.partitions, partitionName)
+	schema, name := SplitQualifiedName(partitionName)
+	partition := &TableInfo{
+		Schema:      schema,
+		Name:        name,
+		Columns:     slices.Clone(root.Columns),
+		ForeignKeys: map[string]*ForeignKey{},
+		// Partitions can't have nullable columns their partitioned table
+		// doesn't, but can be NOT NULL on their own, which isn't tracked.
+		NotNullColumns: slices.Clone(root.NotNullColumns),
+	}
+	for constraintName, fkey := range root.ForeignKeys {
+		partition.ForeignKeys[constraintName] = &ForeignKey{
+			ToTable:          fkey.ToTable,
+			ColumnConditions: slices.Clone(fkey.ColumnConditions),
+		}
+	}
+	b.tables[partitionName] = partition
+	return nil
+}
+
+// Dropping a column also drops constraints that use it, which in Postgres
+// would require CASCADE if other tables reference it. Columns are dropped from
+// inheriting tables as well.
+func (b *schemaBuilder) dropColumn(tableName string, columnName string) {
+	for _, childName := range b.inheritingTables(tableName) {
+		b.dropColumn(childName, columnName)
+	}
+	table := b.tables[tableName]
+	table.Columns = slices.DeleteFunc(table.Columns, func(column string) bool {
+		return column == columnName
+	})
+	table.NotNullColumns = slices.DeleteFunc(table.NotNullColumns, func(column string) bool {
+		return column == columnName
+	})
+	if slices.Contains(b.primaryKeys[tableName].Columns, columnName) {
+		delete(b.primaryKeys, tableName)
+	}
+	b.dropUniqueKeys(tableName, func(uniqueKey keyConstraint) bool {
+		return slices.Contains(uniqueKey.Columns, columnName)
+	})
+	for _, otherTable := range b.tables {
+		for constraintName, fkey := range otherTable.ForeignKeys {
+			for _, fromToPair := range fkey.ColumnConditions {
+				if (otherTable == table && fromToPair[0] == columnName) || (fkey.ToTable == tableName && fromToPair[1] == columnName) {
+					delete(otherTable.ForeignKeys, constraintName)
+					break
+				}
+			}
+		}
+	}
+}
+
+func (b *schemaBuilder) rename(stmt *pg_query.RenameStmt) error {
+	if stmt.Relation == nil {
+		return nil
+	}
+	if stmt.RenameType == pg_query.ObjectType_OBJECT_INDEX {
+		b.renameUniqueKey(stmt.Relation.Schemaname, stmt.Relation.Relname, stmt.Newname)
+		return nil
+	}
+	tableName := b.resolvedName(stmt.Relation)
+	if parentName, ok := b.partitions[tableName]; ok {
+		// Partitions only have names to rename.
+		if stmt.RenameType == pg_query.ObjectType_OBJECT_TABLE {
+			schema, _ := SplitQualifiedName(tableName)
+			newTableName := QualifiedName(schema, stmt.Newname)
+			delete(b.partitions, tableName)
+			b.partitions[newTableName] = parentName
+			b.renamePartitionParent(tableName, newTableName)
+		}
+		return nil
+	}
+	table, ok := b.tables[tableName]
+	if !ok {
+		if stmt.MissingOk {
+			return nil
+		}
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	switch stmt.RenameType {
+	case pg_query.ObjectType_OBJECT_TABLE:
+		newTableName := QualifiedName(table.Schema, stmt.Newname)
+		table.Name = stmt.Newname
+		delete(b.tables, tableName)
+		b.tables[newTableName] = table
+		if pkey, ok := b.primaryKeys[tableName]; ok {
+			delete(b.primaryKeys, tableName)
+			b.primaryKeys[newTableName] = pkey
+		}
+		if uniqueKeys, ok := b.uniqueKeys[tableName]; ok {
+			delete(b.uniqueKeys, tableName)
+			b.uniqueKeys[newTableName] = uniqueKeys
+		}
+		for _, otherTable := range b.tables {
+			for _, fkey := range otherTable.ForeignKeys {
+				if fkey.ToTable == tableName {
+					fkey.ToTable = newTableName
+				}
+			}
+			for i := range otherTable.Inherits {
+				if otherTable.Inherits[i] == tableName {
+					otherTable.Inherits[i] = newTableName
+				}
+			}
+		}
+		b.renamePartitionParent(tableName, newTableName)
+	case pg_query.ObjectType_OBJECT_COLUMN:
+		return b.renameColumn(tableName, stmt.Subname, stmt.Newname)
+	case pg_query.ObjectType_OBJECT_TABCONSTRAINT:
+		if fkey, ok := table.ForeignKeys[stmt.Subname]; ok {
+			delete(table.ForeignKeys, stmt.Subname)
+			table.ForeignKeys[stmt.Newname] = fkey
+		} else if pkey, ok := b.primaryKeys[tableName]; ok && pkey.Name == stmt.Subname {
+			pkey.Name = stmt.Newname
+			b.primaryKeys[tableName] = pkey
+		} else {
+			// Unique constraints are renamed along with their index.
+			b.renameUniqueKey(table.Schema, stmt.Subname, stmt.Newname)
+		}
+	}
+	return nil
+}
+
+func (b *schemaBuilder) renamePartitionParent(tableName string, newTableName string) {
+	for partitionName, parentName := range b.partitions {
+		if parentName == tableName {
+			b.partitions[partitionName] = newTableName
+		}
+	}
+}
+
+// Renaming a column also renames it in inheriting tables.
+func (b *schemaBuilder) renameColumn(tableName string, columnName string, newColumnName string) error {
+	table := b.tables[tableName]
+	index := slices.Index(table.Columns, columnName)
+	if index == -1 {
+		return fmt.Errorf("column %s of table %s does not exist", columnName, tableName)
+	}
+	table.Columns[index] = newColumnName
+	if index := slices.Index(table.NotNullColumns, columnName); index != -1 {
+		table.NotNullColumns[index] = newColumnName
+	}
+	if pkey, ok := b.primaryKeys[tableName]; ok {
+		for i := range pkey.Columns {
+			if pkey.Columns[i] == columnName {
+				pkey.Columns[i] = newColumnName
+			}
+		}
+	}
+	for _, uniqueKey := range b.uniqueKeys[tableName] {
+		for i := range uniqueKey.Columns {
+			if uniqueKey.Columns[i] == columnName {
+				uniqueKey.Columns[i] = newColumnName
+			}
+		}
+	}
+	for _, otherTable := range b.tables {
+		for _, fkey := range otherTable.ForeignKeys {
+			for i := range fkey.ColumnConditions {
+				if otherTable == table && fkey.ColumnConditions[i][0] == columnName {
+					fkey.ColumnConditions[i][0] = newColumnName
+				}
+				if fkey.ToTable == tableName && fkey.ColumnConditions[i][1] == columnName {
+					fkey.ColumnConditions[i][1] = newColumnName
+				}
+			}
+		}
+	}
+	for _, childName := range b.inheritingTables(tableName) {
+		err := b.renameColumn(childName, columnName, newColumnName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dropping a table also drops foreign keys that reference it and tables that
+// inherit from it, which in Postgres would require CASCADE.
+func (b *schemaBuilder) dropTables(stmt *pg_query.DropStmt) error {
+	if stmt.RemoveType == pg_query.ObjectType_OBJECT_INDEX {
+		for _, object := range stmt.Objects {
+			names := stringValues(object.GetList().GetItems())
+			schema := ""
+			if len(names) > 1 {
+				schema = names[len(names)-2]
+			}
+			b.dropIndex(schema, names[len(names)-1])
+		}
+		return nil
+	}
+	if stmt.RemoveType != pg_query.ObjectType_OBJECT_TABLE && stmt.RemoveType != pg_query.ObjectType_OBJECT_VIEW && stmt.RemoveType != pg_query.ObjectType_OBJECT_MATVIEW {
+		return nil
+	}
+	for _, object := range stmt.Objects {
+		names := stringValues(object.GetList().GetItems())
+		relation := &pg_query.RangeVar{Relname: names[len(names)-1]}
+		if len(names) > 1 {
+			relation.Schemaname = names[len(names)-2]
+		}
+		tableName := b.resolvedName(relation)
+		_, isTable := b.tables[tableName]
+		_, isPartition := b.partitions[tableName]
+		if !isTable && !isPartition {
+			if stmt.MissingOk {
+				continue
+			}
+			return fmt.Errorf("table %s does not exist", tableName)
+		}
+		b.dropTable(tableName)
+	}
+	return nil
+}
+
+func (b *schemaBuilder) dropTable(tableName string) {
+	delete(b.tables, tableName)
+	delete(b.primaryKeys, tableName)
+	delete(b.uniqueKeys, tableName)
+	delete(b.partitions, tableName)
+	for partitionName, parentName := range b.partitions {
+		if parentName == tableName {
+			b.dropTable(partitionName)
+		}
+	}
+	for otherTableName, otherTable := range b.tables {
+		for constraintName, fkey := range otherTable.ForeignKeys {
+			if fkey.ToTable == tableName {
+				delete(otherTable.ForeignKeys, constraintName)
+			}
+		}
+		if slices.Contains(otherTable.Inherits, tableName) {
+			b.dropTable(otherTableName)
+		}
+	}
+}
+
+// Comments are tracked by table, rather than table name, so that they follow
+// tables that are renamed.
+func (b *schemaBuilder) comment(stmt *pg_query.CommentStmt) error {
+	names := stringValues(stmt.Object.GetList().GetItems())
+	comment := objectComment{Comment: stmt.Comment}
+	switch stmt.Objtype {
+	case pg_query.ObjectType_OBJECT_TABLE, pg_query.ObjectType_OBJECT_VIEW, pg_query.ObjectType_OBJECT_MATVIEW, pg_query.ObjectType_OBJECT_FOREIGN_TABLE:
+	case pg_query.ObjectType_OBJECT_COLUMN:
+		comment.Column = names[len(names)-1]
+		names = names[:len(names)-1]
+	case pg_query.ObjectType_OBJECT_TABCONSTRAINT:
+		comment.Constraint = names[len(names)-1]
+		names = names[:len(names)-1]
+	default:
+		return nil
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	relation := &pg_query.RangeVar{Relname: names[len(names)-1]}
+	if len(names) > 1 {
+		relation.Schemaname = names[len(names)-2]
+	}
+	tableName := b.resolvedName(relation)
+	table, ok := b.tables[tableName]
+	if !ok {
+		if _, ok := b.partitions[tableName]; ok {
+			return nil
+		}
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	comment.Table = table
+	// Commenting again replaces the previous comment.
+	b.comments = slices.DeleteFunc(b.comments, func(other objectComment) bool {
+		return other.Table == comment.Table && other.Column == comment.Column && other.Constraint == comment.Constraint
+	})
+	b.comments = append(b.comments, comment)
+	return nil
+}
+
+// Column constraints don't list their column, so it has to be passed in.
+func (b *schemaBuilder) addPrimaryKey(tableName string, constraint *pg_query.Constraint, columns []string) {
+	if columns == nil {
+		columns = stringValues(constraint.Keys)
+	}
+	constraintName := constraint.Conname
+	if constraintName == "" {
+		constraintName = makeObjectName(b.tables[tableName].Name, "", "pkey")
+	}
+	b.primaryKeys[tableName] = keyConstraint{constraintName, columns}
+	// Primary key columns are implicitly NOT NULL.
+	for _, column := range columns {
+		b.setNotNull(tableName, column, true)
+	}
+}
+
+// Column constraints don't list their column, so it has to be passed in.
+func (b *schemaBuilder) addUniqueKey(tableName string, constraint *pg_query.Constraint, columns []string) {
+	if columns == nil {
+		columns = stringValues(constraint.Keys)
+	}
+	constraintName := constraint.Conname
+	if constraintName == "" {
+		constraintName = makeObjectName(b.tables[tableName].Name, strings.Join(columns, "_"), "key")
+	}
+	b.uniqueKeys[tableName] = append(b.uniqueKeys[tableName], keyConstraint{constraintName, columns})
+}
+
+// Unique indexes are tracked like unique constraints, unless they're partial
+// or use expressions, since those can't be used to tell if a join is to-one.
+func (b *schemaBuilder) createIndex(stmt *pg_query.IndexStmt) error {
+	if !stmt.Unique || stmt.WhereClause != nil {
+		return nil
+	}
+	columns := []string{}
+	for _, node := range stmt.IndexParams {
+		indexElem := node.GetIndexElem()
+		if indexElem == nil || indexElem.Name == "" {
+			return nil
+		}
+		columns = append(columns, indexElem.Name)
+	}
+	tableName := b.resolvedName(stmt.Relation)
+	if _, ok := b.partitions[tableName]; ok {
+		return nil
+	}
+	if _, ok := b.tables[tableName]; !ok {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	indexName := stmt.Idxname
+	if indexName == "" {
+		indexName = makeObjectName(b.tables[tableName].Name, strings.Join(columns, "_"), "idx")
+	}
+	b.uniqueKeys[tableName] = append(b.uniqueKeys[tableName], keyConstraint{indexName, columns})
+	return nil
+}
+
+func (b *schemaBuilder) dropUniqueKeys(tableName string, drop func(uniqueKey keyConstraint) bool) {
+	b.uniqueKeys[tableName] = slices.DeleteFunc(b.uniqueKeys[tableName], drop)
+}
+
+// Indexes are named uniquely within a schema, so they can be found without
+// knowing their table.
+func (b *schemaBuilder) dropIndex(schema string, indexName string) {
+	for tableName, table := range b.tables {
+		if schema == "" || table.Schema == schema {
+			b.dropUniqueKeys(tableName, func(uniqueKey keyConstraint) bool {
+				return uniqueKey.Name == indexName
+			})
+		}
+	}
+}
+
+func (b *schemaBuilder) renameUniqueKey(schema string, indexName string, newIndexName string) {
+	for tableName, table := range b.tables {
+		if schema != "" && table.Schema != schema {
+			continue
+		}
+		for i := range b.uniqueKeys[tableName] {
+			if b.uniqueKeys[tableName][i].Name == indexName {
+				b.uniqueKeys[tableName][i].Name = newIndexName
+			}
+		}
+	}
+}
+
+// NOT NULL is inherited, so it's set on inheriting tables as well.
+func (b *schemaBuilder) setNotNull(tableName string, columnName string, notNull bool) {
+	table := b.tables[tableName]
+	table.NotNullColumns = slices.DeleteFunc(table.NotNullColumns, func(column string) bool {
+		return column == columnName
+	})
+	if notNull {
+		table.NotNullColumns = append(table.NotNullColumns, columnName)
+	}
+	for _, childName := range b.inheritingTables(tableName) {
+		b.setNotNull(childName, columnName, notNull)
+	}
+}
+
+func (b *schemaBuilder) addForeignKey(tableName string, constraint *pg_query.Constraint, columns []string) error {
+	if columns == nil {
+		columns = stringValues(constraint.FkAttrs)
+	}
+	toTableName := b.rootTable(b.resolvedName(constraint.Pktable))
+	toColumns := stringValues(constraint.PkAttrs)
+	if len(toColumns) == 0 {
+		toColumns = b.primaryKeys[toTableName].Columns
+	}
+	if len(toColumns) != len(columns) {
+		return fmt.Errorf("could not determine referenced columns of %s for foreign key on %s", toTableName, tableName)
+	}
+
+	table := b.tables[tableName]
+	constraintName := constraint.Conname
+	if constraintName == "" {
+		constraintName = b.chooseConstraintName(table, strings.Join(columns, "_"), "fkey")
+	}
+	fkey := &ForeignKey{
+		ToTable:          toTableName,
+		ColumnConditions: [][2]string{},
+	}
+	for i := range columns {
+		fkey.ColumnConditions = append(fkey.ColumnConditions, [2]string{columns[i], toColumns[i]})
+	}
+	table.ForeignKeys[constraintName] = fkey
+	return nil
+}
+
+// Mimics Postgres' ChooseConstraintName so that unnamed constraints end up
+// with the same names they would have in a real database.
+func (b *schemaBuilder) chooseConstraintName(table *TableInfo, columns string, label string) string {
+	for pass := 0; ; pass++ {
+		passLabel := label
+		if pass > 0 {
+			passLabel += strconv.Itoa(pass)
+		}
+		constraintName := makeObjectName(table.Name, columns, passLabel)
+		conflicts := false
+		for _, otherTable := range b.tables {
+			if _, ok := otherTable.ForeignKeys[constraintName]; ok && otherTable.Schema == table.Schema {
+				conflicts = true
+				break
+			}
+		}
+		if !conflicts {
+			return constraintName
+		}
+	}
+}
+
+// Mimics Postgres' makeObjectName, which truncates the longer of the two names
+// until the result fits in an identifier.
+func makeObjectName(name1, name2, label string) string {
+	overhead := len(label) + 1
+	if name2 != "" {
+		overhead++
+	}
+	name1Length := len(name1)
+	name2Length := len(name2)
+	for name1Length+name2Length > maxIdentifierLength-overhead {
+		if name1Length > name2Length {
+			name1Length--
+		} else {
+			name2Length--
+		}
+	}
+	objectName := name1[:name1Length]
+	if name2 != "" {
+		objectName += "_" + name2[:name2Length]
+	}
+	return objectName + "_" + label
+}
+
+func stringValues(nodes []*pg_query.Node) []string {
+	values := []string{}
+	for _, node := range nodes {
+		if node.GetString_() != nil {
+			values = append(values, node.GetString_().Sval)
+		}
+	}
+	return values
+}
@@ -0,0 +1,120 @@
+package dbinfo
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Differences between two schemas that can change how queries are joined.
+// Columns are formatted as "schema.table.column", and foreign keys as
+// "schema.table.constraint (columns) -> schema.table (columns)".
+type SchemaDiff struct {
+	AddedTables        []string
+	RemovedTables      []string
+	AddedColumns       []string
+	RemovedColumns     []string
+	AddedForeignKeys   []string
+	RemovedForeignKeys []string
+	// Column names that more than one table has, which changes what table
+	// unqualified columns are joined from.
+	NewlyAmbiguousColumns    []string
+	NoLongerAmbiguousColumns []string
+}
+
+func (d SchemaDiff) IsEmpty() bool {
+	return len(d.AddedTables) == 0 && len(d.RemovedTables) == 0 &&
+		len(d.AddedColumns) == 0 && len(d.RemovedColumns) == 0 &&
+		len(d.AddedForeignKeys) == 0 && len(d.RemovedForeignKeys) == 0 &&
+		len(d.NewlyAmbiguousColumns) == 0 && len(d.NoLongerAmbiguousColumns) == 0
+}
+
+// Compares two schemas, ex: before and after a migration.
+func Diff(from DatabaseInfo, to DatabaseInfo) SchemaDiff {
+	diff := SchemaDiff{}
+	diff.AddedTables, diff.RemovedTables = diffSets(tableNames(from), tableNames(to))
+	// Columns of added or removed tables would just be noise.
+	diff.AddedColumns, diff.RemovedColumns = diffSets(qualifiedColumns(from, to), qualifiedColumns(to, from))
+	diff.AddedForeignKeys, diff.RemovedForeignKeys = diffSets(describedForeignKeys(from), describedForeignKeys(to))
+	diff.NewlyAmbiguousColumns, diff.NoLongerAmbiguousColumns = diffSets(ambiguousColumns(from), ambiguousColumns(to))
+	return diff
+}
+
+// Returns sorted values that are only in b, and only in a.
+func diffSets(a map[string]bool, b map[string]bool) ([]string, []string) {
+	added := []string{}
+	removed := []string{}
+	for _, value := range slices.Sorted(maps.Keys(b)) {
+		if !a[value] {
+			added = append(added, value)
+		}
+	}
+	for _, value := range slices.Sorted(maps.Keys(a)) {
+		if !b[value] {
+			removed = append(removed, value)
+		}
+	}
+	return added, removed
+}
+
+func tableNames(databaseInfo DatabaseInfo) map[string]bool {
+	names := map[string]bool{}
+	for tableName := range databaseInfo.Tables {
+		names[tableName] = true
+	}
+	return names
+}
+
+// Returns columns of tables that exist in both schemas.
+func qualifiedColumns(databaseInfo DatabaseInfo, otherDatabaseInfo DatabaseInfo) map[string]bool {
+	columns := map[string]bool{}
+	for tableName, table := range databaseInfo.Tables {
+		if _, ok := otherDatabaseInfo.Tables[tableName]; !ok {
+			continue
+		}
+		for _, column := range table.Columns {
+			columns[tableName+"."+column] = true
+		}
+	}
+	return columns
+}
+
+// Foreign keys are described in full so that changing what a constraint
+// references shows up as removing and adding it. Foreign keys copied for views
+// change along with the foreign keys they're copied from, so they're skipped.
+func describedForeignKeys(databaseInfo DatabaseInfo) map[string]bool {
+	fkeys := map[string]bool{}
+	for tableName, table := range databaseInfo.Tables {
+		for constraintName, fkey := range table.ForeignKeys {
+			if fkey.ViaView {
+				continue
+			}
+			fromColumns := []string{}
+			toColumns := []string{}
+			for _, fromToPair := range fkey.ColumnConditions {
+				fromColumns = append(fromColumns, fromToPair[0])
+				toColumns = append(toColumns, fromToPair[1])
+			}
+			fkeys[fmt.Sprintf(
+				"%s.%s (%s) -> %s (%s)",
+				tableName,
+				constraintName,
+				strings.Join(fromColumns, ", "),
+				fkey.ToTable,
+				strings.Join(toColumns, ", "),
+			)] = true
+		}
+	}
+	return fkeys
+}
+
+func ambiguousColumns(databaseInfo DatabaseInfo) map[string]bool {
+	columns := map[string]bool{}
+	for column, tableNames := range databaseInfo.ColumnToTable {
+		if len(tableNames) > 1 {
+			columns[column] = true
+		}
+	}
+	return columns
+}
@@ -0,0 +1,109 @@
+package dbinfo
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Rules for inferring foreign keys from column names, for schemas that don't
+// use constraints. By default orders.customer_id references the primary key of
+// customers, if it has a single column primary key.
+type InferenceRules struct {
+	// Suffixes of columns that reference other tables. Defaults to "_id".
+	Suffixes []string `yaml:"suffixes"`
+	// Prefixes removed from columns before looking for a table (ex: "fk_").
+	Prefixes []string `yaml:"prefixes"`
+	// Plurals that don't follow the usual English rules (ex: person: people).
+	Plurals map[string]string `yaml:"plurals"`
+	// Set if table names are singular (ex: customer instead of customers).
+	Singular bool `yaml:"singular"`
+}
+
+// Adds foreign keys for columns that look like references to other tables.
+// Columns that are already used by a foreign key are skipped, so this should
+// be called after adding declared relationships.
+func (d DatabaseInfo) InferForeignKeys(rules InferenceRules) {
+	suffixes := rules.Suffixes
+	if len(suffixes) == 0 {
+		suffixes = []string{"_id"}
+	}
+	for _, tableName := range slices.Sorted(maps.Keys(d.Tables)) {
+		table := d.Tables[tableName]
+		for _, column := range table.Columns {
+			if hasForeignKeyColumn(table, column) {
+				continue
+			}
+			toTableName, ok := d.inferReferencedTable(table, column, suffixes, rules)
+			if !ok {
+				continue
+			}
+			constraintName := uniqueConstraintName(table, column, "inferred")
+			table.ForeignKeys[constraintName] = &ForeignKey{
+				ToTable:          toTableName,
+				ColumnConditions: [][2]string{{column, d.Tables[toTableName].PrimaryKey[0]}},
+				Inferred:         true,
+			}
+			d.addForeignKeyEdge(tableName, constraintName)
+		}
+	}
+}
+
+// Looks for a table with a single column primary key that's named after the
+// column, in the column's schema and then the default search_path.
+func (d DatabaseInfo) inferReferencedTable(table *TableInfo, column string, suffixes []string, rules InferenceRules) (string, bool) {
+	for _, suffix := range suffixes {
+		stem, ok := strings.CutSuffix(column, suffix)
+		if !ok || stem == "" {
+			continue
+		}
+		for _, prefix := range rules.Prefixes {
+			if trimmedStem, ok := strings.CutPrefix(stem, prefix); ok && trimmedStem != "" {
+				stem = trimmedStem
+				break
+			}
+		}
+		names := []string{stem}
+		if !rules.Singular {
+			names = []string{pluralize(stem, rules.Plurals), stem}
+		}
+		schemas := append([]string{table.Schema}, ParseSearchPath(DefaultSearchPath, "")...)
+		for _, schema := range schemas {
+			for _, name := range names {
+				toTableName := QualifiedName(schema, name)
+				toTable, ok := d.Tables[toTableName]
+				if !ok || toTable == table || len(toTable.PrimaryKey) != 1 {
+					continue
+				}
+				return toTableName, true
+			}
+		}
+	}
+	return "", false
+}
+
+func hasForeignKeyColumn(table *TableInfo, column string) bool {
+	for _, fkey := range table.ForeignKeys {
+		for _, fromToPair := range fkey.ColumnConditions {
+			if fromToPair[0] == column {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Handles the common English plurals, which covers most table names.
+func pluralize(word string, plurals map[string]string) string {
+	if plural, ok := plurals[word]; ok {
+		return plural
+	}
+	switch {
+	case strings.HasSuffix(word, "s") || strings.HasSuffix(word, "x") || strings.HasSuffix(word, "z") ||
+		strings.HasSuffix(word, "ch") || strings.HasSuffix(word, "sh"):
+		return word + "es"
+	case strings.HasSuffix(word, "y") && len(word) > 1 && !strings.ContainsRune("aeiou", rune(word[len(word)-2])):
+		return word[:len(word)-1] + "ies"
+	}
+	return word + "s"
+}
@@ -0,0 +1,90 @@
+package dbinfo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Migration files start with a version (ex: 20240101120000_create_users.up.sql
+// or 00001_create_users.sql), which is usually a number or timestamp.
+var migrationVersionRegexp = regexp.MustCompile(`^0*(\d+)`)
+
+// Gathers information about every table's column and foreign key by applying a
+// directory of migrations in order, as of the latest migration. Supports
+// golang-migrate style (*.up.sql and *.down.sql) and goose style
+// (-- +goose Up and -- +goose Down) files.
+func GetDatabaseInfoFromMigrations(dir string) (DatabaseInfo, error) {
+	migrationFiles, err := migrationFilesInOrder(dir)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+
+	builder := newSchemaBuilder()
+	for _, migrationFile := range migrationFiles {
+		contents, err := os.ReadFile(filepath.Join(dir, migrationFile))
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+		err = builder.apply(migrationUpSQL(string(contents)))
+		if err != nil {
+			return DatabaseInfo{}, fmt.Errorf("could not apply migration %s: %w", migrationFile, err)
+		}
+	}
+	return builder.databaseInfo(), nil
+}
+
+func migrationFilesInOrder(dir string) ([]string, error) {
+	dirEntry, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	migrationFiles := []string{}
+	for _, e := range dirEntry {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") || strings.HasSuffix(e.Name(), ".down.sql") {
+			continue
+		}
+		migrationFiles = append(migrationFiles, e.Name())
+	}
+	// Versions aren't always zero-padded, so compare them as numbers.
+	slices.SortFunc(migrationFiles, func(a, b string) int {
+		aVersion := migrationVersionRegexp.FindStringSubmatch(a)
+		bVersion := migrationVersionRegexp.FindStringSubmatch(b)
+		if aVersion != nil && bVersion != nil {
+			if len(aVersion[1]) != len(bVersion[1]) {
+				return len(aVersion[1]) - len(bVersion[1])
+			}
+			if aVersion[1] != bVersion[1] {
+				return strings.Compare(aVersion[1], bVersion[1])
+			}
+		}
+		return strings.Compare(a, b)
+	})
+	return migrationFiles, nil
+}
+
+// Returns the up section of goose migrations, or the whole file otherwise.
+func migrationUpSQL(contents string) string {
+	if !strings.Contains(contents, "-- +goose Up") {
+		return contents
+	}
+	upLines := []string{}
+	isUp := false
+	for _, line := range strings.Split(contents, "\n") {
+		trimmedLine := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmedLine, "-- +goose Up") {
+			isUp = true
+			continue
+		} else if strings.HasPrefix(trimmedLine, "-- +goose Down") {
+			isUp = false
+			continue
+		}
+		if isUp {
+			upLines = append(upLines, line)
+		}
+	}
+	return strings.Join(upLines, "\n")
+}
@@ -0,0 +1,139 @@
+package dbinfo
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Relationships that aren't real foreign key constraints (ex: soft references
+// kept for performance, or references to foreign tables), read from a YAML or
+// JSON file like:
+//
+//	foreign_keys:
+//	  - orders.customer_ref -> customers.external_id
+//	  - billing.line_items(invoice_id, line_no) -> billing.invoice_lines(invoice_id, line_no)
+//	infer:
+//	  prefixes: [fk_]
+type Relationships struct {
+	ForeignKeys []string `yaml:"foreign_keys"`
+	// If set, foreign keys are also inferred from column names.
+	Infer *InferenceRules `yaml:"infer"`
+}
+
+// Reads relationships from YAML, or JSON since it's also valid YAML.
+func LoadRelationships(r io.Reader) (Relationships, error) {
+	var relationships Relationships
+	err := yaml.NewDecoder(r).Decode(&relationships)
+	if err == io.EOF {
+		return relationships, nil
+	}
+	return relationships, err
+}
+
+// Adds declared relationships as foreign keys, so that they're joined like
+// real constraints. Unqualified tables are resolved using the default
+// search_path. Relationships that are already foreign keys are skipped (ex:
+// when a snapshot was saved with the same relationships).
+func (d DatabaseInfo) AddRelationships(relationships Relationships) error {
+	searchPath := ParseSearchPath(DefaultSearchPath, "")
+	for _, declaration := range relationships.ForeignKeys {
+		from, to, ok := strings.Cut(declaration, "->")
+		if !ok {
+			return fmt.Errorf("could not parse relationship %q, expected \"table.column -> table.column\"", declaration)
+		}
+		fromTableName, fromColumns, err := d.parseRelationshipSide(from, searchPath)
+		if err != nil {
+			return fmt.Errorf("could not parse relationship %q: %w", declaration, err)
+		}
+		toTableName, toColumns, err := d.parseRelationshipSide(to, searchPath)
+		if err != nil {
+			return fmt.Errorf("could not parse relationship %q: %w", declaration, err)
+		}
+		if len(fromColumns) != len(toColumns) {
+			return fmt.Errorf("could not parse relationship %q, both sides must have the same number of columns", declaration)
+		}
+
+		fkey := &ForeignKey{
+			ToTable:          toTableName,
+			ColumnConditions: [][2]string{},
+			Declared:         true,
+		}
+		for i := range fromColumns {
+			fkey.ColumnConditions = append(fkey.ColumnConditions, [2]string{fromColumns[i], toColumns[i]})
+		}
+		fromTable := d.Tables[fromTableName]
+		if hasForeignKey(fromTable, fkey) {
+			continue
+		}
+		constraintName := uniqueConstraintName(fromTable, strings.Join(fromColumns, "_"), "declared")
+		fromTable.ForeignKeys[constraintName] = fkey
+		d.addForeignKeyEdge(fromTableName, constraintName)
+	}
+	if relationships.Infer != nil {
+		d.InferForeignKeys(*relationships.Infer)
+	}
+	return nil
+}
+
+// Parses "table.column", "schema.table.column", or "table(column, column)"
+// into a qualified table name and its columns.
+func (d DatabaseInfo) parseRelationshipSide(side string, searchPath []string) (string, []string, error) {
+	side = strings.TrimSpace(side)
+	var tableName string
+	var columns []string
+	if before, after, ok := strings.Cut(side, "("); ok && strings.HasSuffix(after, ")") {
+		tableName = strings.TrimSpace(before)
+		for _, column := range strings.Split(strings.TrimSuffix(after, ")"), ",") {
+			columns = append(columns, strings.TrimSpace(column))
+		}
+	} else {
+		index := strings.LastIndex(side, ".")
+		if index == -1 {
+			return "", nil, fmt.Errorf("%s is missing a table", side)
+		}
+		tableName = side[:index]
+		columns = []string{side[index+1:]}
+	}
+
+	qualifiedName, ok := d.ResolveTable(tableName, searchPath)
+	if !ok {
+		return "", nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	for _, column := range columns {
+		if !slices.Contains(d.Tables[qualifiedName].Columns, column) {
+			return "", nil, fmt.Errorf("column %s of table %s does not exist", column, qualifiedName)
+		}
+	}
+	return qualifiedName, columns, nil
+}
+
+// Returns true if a table has a foreign key with the same columns and
+// referenced table.
+func hasForeignKey(table *TableInfo, fkey *ForeignKey) bool {
+	for _, otherFkey := range table.ForeignKeys {
+		if otherFkey.ToTable == fkey.ToTable && slices.Equal(otherFkey.ColumnConditions, fkey.ColumnConditions) {
+			return true
+		}
+	}
+	return false
+}
+
+// Foreign keys that aren't real constraints are named like real ones, but
+// can't conflict with them.
+func uniqueConstraintName(table *TableInfo, columns string, label string) string {
+	for pass := 0; ; pass++ {
+		passLabel := label
+		if pass > 0 {
+			passLabel += strconv.Itoa(pass)
+		}
+		constraintName := makeObjectName(table.Name, columns, passLabel)
+		if _, ok := table.ForeignKeys[constraintName]; !ok {
+			return constraintName
+		}
+	}
+}
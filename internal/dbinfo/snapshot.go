@@ -0,0 +1,153 @@
+package dbinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+// Bumped whenever the snapshot format changes in a way older versions of
+// pg-autojoin can't read.
+const snapshotVersion = 1
+
+// A JSON-friendly copy of DatabaseInfo. Tables and foreign keys are sorted so
+// that snapshots are stable enough to commit.
+type snapshot struct {
+	Version int             `json:"version"`
+	Tables  []snapshotTable `json:"tables"`
+}
+
+type snapshotTable struct {
+	Schema      string               `json:"schema"`
+	Name        string               `json:"name"`
+	Columns     []string             `json:"columns"`
+	ForeignKeys []snapshotForeignKey `json:"foreign_keys"`
+	PrimaryKey  []string             `json:"primary_key,omitempty"`
+	UniqueKeys  [][]string           `json:"unique_keys,omitempty"`
+	NotNull     []string             `json:"not_null,omitempty"`
+	Inherits    []string             `json:"inherits,omitempty"`
+	Ignored     bool                 `json:"ignored,omitempty"`
+	RowEstimate float64              `json:"row_estimate,omitempty"`
+	// View column -> the table column it passes through.
+	ViewColumns map[string]snapshotViewColumn `json:"view_columns,omitempty"`
+}
+
+type snapshotViewColumn struct {
+	Source string `json:"source"`
+	Table  string `json:"table"`
+	Column string `json:"column"`
+}
+
+type snapshotForeignKey struct {
+	Name             string      `json:"name"`
+	ToTable          string      `json:"to_table"`
+	ColumnConditions [][2]string `json:"column_conditions"`
+	Declared         bool        `json:"declared,omitempty"`
+	Inferred         bool        `json:"inferred,omitempty"`
+	Preferred        bool        `json:"preferred,omitempty"`
+}
+
+// Writes a versioned JSON snapshot of the given database info. Foreign keys
+// copied for views aren't saved, since Load copies them again from the columns
+// views pass through.
+func Save(w io.Writer, databaseInfo DatabaseInfo) error {
+	s := snapshot{
+		Version: snapshotVersion,
+		Tables:  []snapshotTable{},
+	}
+	for _, tableName := range slices.Sorted(maps.Keys(databaseInfo.Tables)) {
+		table := databaseInfo.Tables[tableName]
+		snapshotTable := snapshotTable{
+			Schema:      table.Schema,
+			Name:        table.Name,
+			Columns:     table.Columns,
+			ForeignKeys: []snapshotForeignKey{},
+			PrimaryKey:  table.PrimaryKey,
+			UniqueKeys:  table.UniqueKeys,
+			NotNull:     table.NotNullColumns,
+			Inherits:    table.Inherits,
+			Ignored:     table.Ignored,
+			RowEstimate: table.RowEstimate,
+		}
+		for viewColumn, passthrough := range table.viewColumns {
+			if snapshotTable.ViewColumns == nil {
+				snapshotTable.ViewColumns = map[string]snapshotViewColumn{}
+			}
+			snapshotTable.ViewColumns[viewColumn] = snapshotViewColumn(passthrough)
+		}
+		for _, constraintName := range slices.Sorted(maps.Keys(table.ForeignKeys)) {
+			fkey := table.ForeignKeys[constraintName]
+			if fkey.ViaView {
+				continue
+			}
+			snapshotTable.ForeignKeys = append(snapshotTable.ForeignKeys, snapshotForeignKey{
+				Name:             constraintName,
+				ToTable:          fkey.ToTable,
+				ColumnConditions: fkey.ColumnConditions,
+				Declared:         fkey.Declared,
+				Inferred:         fkey.Inferred,
+				Preferred:        fkey.Preferred,
+			})
+		}
+		s.Tables = append(s.Tables, snapshotTable)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// Reads a snapshot written by Save and rebuilds its database info.
+func Load(r io.Reader) (DatabaseInfo, error) {
+	var s snapshot
+	err := json.NewDecoder(r).Decode(&s)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	if s.Version < 1 || s.Version > snapshotVersion {
+		return DatabaseInfo{}, fmt.Errorf("unsupported snapshot version %d, expected %d or lower", s.Version, snapshotVersion)
+	}
+
+	tableInfo := map[string]*TableInfo{}
+	for _, snapshotTable := range s.Tables {
+		table := &TableInfo{
+			Schema:      snapshotTable.Schema,
+			Name:        snapshotTable.Name,
+			Columns:     snapshotTable.Columns,
+			ForeignKeys: map[string]*ForeignKey{},
+			PrimaryKey:  snapshotTable.PrimaryKey,
+			UniqueKeys:  snapshotTable.UniqueKeys,
+			Inherits:    snapshotTable.Inherits,
+			// Snapshots without not_null treat every column as nullable.
+			NotNullColumns: snapshotTable.NotNull,
+			Ignored:        snapshotTable.Ignored,
+			RowEstimate:    snapshotTable.RowEstimate,
+		}
+		if table.Columns == nil {
+			table.Columns = []string{}
+		}
+		for viewColumn, passthrough := range snapshotTable.ViewColumns {
+			if table.viewColumns == nil {
+				table.viewColumns = map[string]passthroughColumn{}
+			}
+			table.viewColumns[viewColumn] = passthroughColumn(passthrough)
+		}
+		for _, snapshotForeignKey := range snapshotTable.ForeignKeys {
+			fkey := &ForeignKey{
+				ToTable:          snapshotForeignKey.ToTable,
+				ColumnConditions: snapshotForeignKey.ColumnConditions,
+				Declared:         snapshotForeignKey.Declared,
+				Inferred:         snapshotForeignKey.Inferred,
+				Preferred:        snapshotForeignKey.Preferred,
+			}
+			if fkey.ColumnConditions == nil {
+				fkey.ColumnConditions = [][2]string{}
+			}
+			table.ForeignKeys[snapshotForeignKey.Name] = fkey
+		}
+		tableInfo[QualifiedName(table.Schema, table.Name)] = table
+	}
+	addViewForeignKeys(tableInfo)
+	return newDatabaseInfo(tableInfo), nil
+}
@@ -0,0 +1,103 @@
+package dbinfo
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Where to read the schema from instead of a live database, and relationships
+// to join on that aren't real foreign keys. At most one of SchemaFile,
+// MigrationsDir, and SnapshotFile can be set.
+type SchemaSource struct {
+	// A file of DDL statements.
+	SchemaFile string
+	// A directory of migrations, applied in order.
+	MigrationsDir string
+	// A snapshot written by Save.
+	SnapshotFile string
+	// A YAML or JSON file of relationships, see Relationships.
+	RelationshipsFile string
+	// If true, foreign keys are inferred from column names.
+	InferForeignKeys bool
+}
+
+// Returns the file or directory the schema is read from, or "" if it's read
+// from a live database.
+func (s SchemaSource) Path() string {
+	for _, path := range []string{s.SchemaFile, s.MigrationsDir, s.SnapshotFile} {
+		if path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// Returns an error if more than one place to read the schema from is set.
+func (s SchemaSource) Validate() error {
+	count := 0
+	for _, path := range []string{s.SchemaFile, s.MigrationsDir, s.SnapshotFile} {
+		if path != "" {
+			count++
+		}
+	}
+	if count > 1 {
+		return errors.New("only one of a schema file, migrations directory, or snapshot can be used")
+	}
+	return nil
+}
+
+// Gathers information on what columns, tables, and fkeys exist, from conn if
+// no other place to read the schema from is set, plus any relationships.
+func (s SchemaSource) GetDatabaseInfo(ctx context.Context, conn *pgx.Conn) (DatabaseInfo, error) {
+	err := s.Validate()
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	databaseInfo, err := s.getSchemaDatabaseInfo(ctx, conn)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	relationships := Relationships{}
+	if s.RelationshipsFile != "" {
+		file, err := os.Open(s.RelationshipsFile)
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+		defer file.Close()
+		relationships, err = LoadRelationships(file)
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+	}
+	// The relationships file can customize how foreign keys are inferred.
+	if s.InferForeignKeys && relationships.Infer == nil {
+		relationships.Infer = &InferenceRules{}
+	}
+	return databaseInfo, databaseInfo.AddRelationships(relationships)
+}
+
+func (s SchemaSource) getSchemaDatabaseInfo(ctx context.Context, conn *pgx.Conn) (DatabaseInfo, error) {
+	if s.SchemaFile != "" {
+		ddl, err := os.ReadFile(s.SchemaFile)
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+		return GetDatabaseInfoFromDDL(string(ddl))
+	} else if s.MigrationsDir != "" {
+		return GetDatabaseInfoFromMigrations(s.MigrationsDir)
+	} else if s.SnapshotFile != "" {
+		file, err := os.Open(s.SnapshotFile)
+		if err != nil {
+			return DatabaseInfo{}, err
+		}
+		defer file.Close()
+		return Load(file)
+	}
+	if conn == nil {
+		return DatabaseInfo{}, errors.New("a database connection, schema file, migrations directory, or snapshot is required")
+	}
+	return GetDatabaseInfoResult(ctx, conn)
+}
@@ -0,0 +1,5 @@
+ALTER TABLE users RENAME TO accounts;
+ALTER TABLE accounts RENAME COLUMN email TO login;
+ALTER TABLE accounts ADD COLUMN legacy_id INT;
+ALTER TABLE organization_users RENAME COLUMN user_id TO account_id;
+ALTER TABLE organization_users RENAME CONSTRAINT organization_users_user_id_fkey TO organization_users_account_id_fkey;
@@ -0,0 +1,8 @@
+ALTER TABLE accounts DROP COLUMN legacy_id;
+ALTER TABLE organization_users DROP CONSTRAINT organization_users_organization_id_fkey;
+
+CREATE TABLE scratch (
+  id INT NOT NULL PRIMARY KEY,
+  account_id INT NOT NULL REFERENCES accounts(id)
+);
+DROP TABLE scratch;
@@ -0,0 +1,4 @@
+CREATE TABLE users (
+  id INT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL
+);
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE organizations (
+  id INT NOT NULL PRIMARY KEY,
+  name TEXT NOT NULL
+);
+
+CREATE TABLE organization_users (
+  id INT NOT NULL PRIMARY KEY,
+  organization_id INT NOT NULL REFERENCES organizations,
+  user_id INT NOT NULL
+);
+
+ALTER TABLE organization_users ADD FOREIGN KEY (user_id) REFERENCES users(id);
+
+-- +goose Down
+DROP TABLE organization_users;
+DROP TABLE organizations;
@@ -0,0 +1,200 @@
+package dbinfo
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/mortenson/pg-autojoin/internal/parse"
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+// A view column that is a plain reference to a table column. Source is the
+// table's alias in the view's FROM, which tells apart multiple references to
+// the same table.
+type passthroughColumn struct {
+	Source string
+	Table  string
+	Column string
+}
+
+// Returns the columns a view's query selects, and which of them pass a table
+// column through unchanged. Tables are resolved using the search path that
+// was active when the view was defined.
+func analyzeViewQuery(stmt *pg_query.SelectStmt, tables map[string]*TableInfo, searchPath []string) ([]string, map[string]passthroughColumn) {
+	columns := []string{}
+	passthroughs := map[string]passthroughColumn{}
+	// The first arm of a UNION/INTERSECT/EXCEPT names the columns, but values
+	// could come from any arm.
+	isSetOperation := false
+	for stmt.Op != pg_query.SetOperation_SETOP_NONE && stmt.Larg != nil {
+		stmt = stmt.Larg
+		isSetOperation = true
+	}
+
+	// Alias (or relation name) -> qualified table name, in FROM order.
+	sources := []string{}
+	sourceTables := map[string]string{}
+	var addSources func(node *pg_query.Node)
+	addSources = func(node *pg_query.Node) {
+		if rangeVar := node.GetRangeVar(); rangeVar != nil {
+			tableName := QualifiedName(rangeVar.Schemaname, rangeVar.Relname)
+			if rangeVar.Schemaname == "" {
+				for _, schema := range searchPath {
+					if _, ok := tables[QualifiedName(schema, rangeVar.Relname)]; ok {
+						tableName = QualifiedName(schema, rangeVar.Relname)
+						break
+					}
+				}
+			}
+			if _, ok := tables[tableName]; !ok {
+				return
+			}
+			source := rangeVar.Relname
+			if rangeVar.Alias != nil {
+				source = rangeVar.Alias.Aliasname
+			}
+			sources = append(sources, source)
+			sourceTables[source] = tableName
+		} else if joinExpr := node.GetJoinExpr(); joinExpr != nil {
+			addSources(joinExpr.Larg)
+			addSources(joinExpr.Rarg)
+		}
+	}
+	for _, node := range stmt.FromClause {
+		addSources(node)
+	}
+
+	addColumn := func(name string, passthrough *passthroughColumn) {
+		columns = append(columns, name)
+		if passthrough != nil && !isSetOperation {
+			passthroughs[name] = *passthrough
+		}
+	}
+	for _, node := range stmt.TargetList {
+		resTarget := node.GetResTarget()
+		if resTarget == nil {
+			continue
+		}
+		columnRef := resTarget.Val.GetColumnRef()
+		if columnRef == nil {
+			addColumn(parse.TargetName(resTarget), nil)
+			continue
+		}
+		fields := stringValues(columnRef.Fields)
+		isStar := columnRef.Fields[len(columnRef.Fields)-1].GetAStar() != nil
+
+		// Expand * and alias.* into every column of their tables.
+		if isStar {
+			for _, source := range sources {
+				if len(fields) > 0 && fields[len(fields)-1] != source {
+					continue
+				}
+				for _, column := range tables[sourceTables[source]].Columns {
+					addColumn(column, &passthroughColumn{source, sourceTables[source], column})
+				}
+			}
+			continue
+		}
+
+		// Find which table the column comes from, which for unqualified
+		// columns is the only table that has it.
+		column := fields[len(fields)-1]
+		var passthrough *passthroughColumn
+		if len(fields) > 1 {
+			source := fields[len(fields)-2]
+			if tableName, ok := sourceTables[source]; ok && slices.Contains(tables[tableName].Columns, column) {
+				passthrough = &passthroughColumn{source, tableName, column}
+			}
+		} else {
+			for _, source := range sources {
+				if !slices.Contains(tables[sourceTables[source]].Columns, column) {
+					continue
+				}
+				if passthrough != nil {
+					passthrough = nil
+					break
+				}
+				passthrough = &passthroughColumn{source, sourceTables[source], column}
+			}
+		}
+		addColumn(parse.TargetName(resTarget), passthrough)
+	}
+	return columns, passthroughs
+}
+
+// Views don't have foreign keys, but columns they pass through from a table
+// can use that table's foreign keys. A view inherits foreign keys from tables
+// it selects from, and tables that reference those tables get a foreign key to
+// the view as well. Repeats until views of views have their foreign keys.
+func addViewForeignKeys(tables map[string]*TableInfo) {
+	for added := true; added; {
+		added = false
+		for viewName, view := range tables {
+			passthroughs := view.viewColumns
+			if len(passthroughs) == 0 {
+				continue
+			}
+			for tableName, table := range tables {
+				for constraintName, fkey := range table.ForeignKeys {
+					// Foreign keys from a table the view selects from.
+					fromColumns := viewColumnsFor(passthroughs, tableName, fkey, 0)
+					if fromColumns != nil {
+						if _, ok := view.ForeignKeys[constraintName]; !ok && fkey.ToTable != viewName {
+							view.ForeignKeys[constraintName] = viewForeignKey(fkey.ToTable, fkey, fromColumns, 0)
+							added = true
+						}
+					}
+					// Foreign keys to a table the view selects from.
+					toColumns := viewColumnsFor(passthroughs, fkey.ToTable, fkey, 1)
+					viewConstraintName := constraintName + "_via_" + view.Name
+					if toColumns != nil && tableName != viewName {
+						if _, ok := table.ForeignKeys[viewConstraintName]; !ok {
+							table.ForeignKeys[viewConstraintName] = viewForeignKey(viewName, fkey, toColumns, 1)
+							added = true
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Returns the view columns that pass through one side (0 for the referencing
+// columns, 1 for the referenced columns) of a foreign key, or nil if the view
+// doesn't pass through all of them from the same source.
+func viewColumnsFor(passthroughs map[string]passthroughColumn, tableName string, fkey *ForeignKey, side int) []string {
+	if len(fkey.ColumnConditions) == 0 {
+		return nil
+	}
+	viewColumns := []string{}
+	source := ""
+	for _, fromToPair := range fkey.ColumnConditions {
+		found := false
+		for _, viewColumn := range slices.Sorted(maps.Keys(passthroughs)) {
+			passthrough := passthroughs[viewColumn]
+			if passthrough.Table == tableName && passthrough.Column == fromToPair[side] && (source == "" || passthrough.Source == source) {
+				viewColumns = append(viewColumns, viewColumn)
+				source = passthrough.Source
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return viewColumns
+}
+
+// Copies a foreign key with one side replaced by view columns.
+func viewForeignKey(toTable string, fkey *ForeignKey, viewColumns []string, side int) *ForeignKey {
+	viewFkey := *fkey
+	viewFkey.ToTable = toTable
+	viewFkey.ColumnConditions = [][2]string{}
+	viewFkey.ViaView = true
+	for i, fromToPair := range fkey.ColumnConditions {
+		fromToPair[side] = viewColumns[i]
+		viewFkey.ColumnConditions = append(viewFkey.ColumnConditions, fromToPair)
+	}
+	return &viewFkey
+}
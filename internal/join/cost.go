@@ -0,0 +1,68 @@
+package join
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/dominikbraun/graph"
+	"github.com/mortenson/pg-autojoin/internal/dbinfo"
+)
+
+// Scores joins between tables, so that the cheapest path to a table with a
+// missing column is the one joined. Implement this to change which paths are
+// preferred.
+type PathCost interface {
+	// Returns the cost of joining otherTableName from tableName, which must be
+	// greater than 0. The tables always have at least one foreign key between
+	// them.
+	JoinCost(databaseInfo dbinfo.DatabaseInfo, tableName string, otherTableName string) int
+}
+
+// Uses the weights of the relationship graph, which account for preferred
+// foreign keys, row estimates, nullable foreign keys, and foreign keys that
+// were declared or inferred.
+type DefaultPathCost struct{}
+
+func (DefaultPathCost) JoinCost(databaseInfo dbinfo.DatabaseInfo, tableName string, otherTableName string) int {
+	return databaseInfo.EdgeWeight(tableName, otherTableName)
+}
+
+// Finds the cheapest path between two tables and its cost, skipping joins that
+// skip returns true for. Returns nil if there isn't a path.
+func cheapestPath(databaseInfo dbinfo.DatabaseInfo, adjacencyMap map[string]map[string]graph.Edge[string], pathCost PathCost, tableName string, otherTableName string, skip func(tableName string, otherTableName string) bool) ([]string, int) {
+	costs := map[string]int{tableName: 0}
+	previous := map[string]string{}
+	visited := map[string]bool{}
+	for {
+		// Visit the cheapest table that hasn't been visited yet, breaking ties
+		// by name so that paths are always the same.
+		current := ""
+		for _, next := range slices.Sorted(maps.Keys(costs)) {
+			if !visited[next] && (current == "" || costs[next] < costs[current]) {
+				current = next
+			}
+		}
+		if current == "" {
+			return nil, 0
+		}
+		if current == otherTableName {
+			path := []string{current}
+			for current != tableName {
+				current = previous[current]
+				path = append([]string{current}, path...)
+			}
+			return path, costs[otherTableName]
+		}
+		visited[current] = true
+		for _, next := range slices.Sorted(maps.Keys(adjacencyMap[current])) {
+			if visited[next] || (skip != nil && skip(current, next)) {
+				continue
+			}
+			cost := costs[current] + max(pathCost.JoinCost(databaseInfo, current, next), 1)
+			if existingCost, ok := costs[next]; !ok || cost < existingCost {
+				costs[next] = cost
+				previous[next] = current
+			}
+		}
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"slices"
 	"strings"
 
-	"github.com/dominikbraun/graph"
 	"github.com/mortenson/pg-autojoin/internal/dbinfo"
 	"github.com/mortenson/pg-autojoin/internal/parse"
 	pg_query "github.com/pganalyze/pg_query_go/v5"
@@ -18,89 +17,388 @@ type JoinBehavior string
 var (
 	JoinBehaviorLeftJoin  JoinBehavior = "JoinBehaviorLeftJoin"
 	JoinBehaviorInnerJoin JoinBehavior = "JoinBehaviorInnerJoin"
+	// Uses inner joins when they can't drop rows, and left joins otherwise.
+	JoinBehaviorAuto JoinBehavior = "JoinBehaviorAuto"
+	// Like JoinBehaviorAuto, but columns from tables that can have more than
+	// one row per row of the query are aggregated into arrays, so the query
+	// returns the same number of rows.
+	JoinBehaviorAggregate JoinBehavior = "JoinBehaviorAggregate"
 )
 
 // Useful information for telling the end user what happened during the join.
 type MissingJoinResult struct {
 	MissingColumnsToJoinedTables   map[string]string
 	MissingColumnsToPossibleTables map[string]map[string]string
+	// Joins in the order they were added to the query.
+	Joins []AddedJoin
+	// Aliases generated for joined tables, mapped to the qualified table name.
+	JoinedAliases map[string]string
+	// True if a join can match more than one row, so the query can return
+	// more rows than it would have without joins.
+	MultipliesRows bool
+	// Positions of the first statement's returned columns that come from
+	// joined tables -> how the table is referenced (ex: users_created_by for
+	// created_by.email). Positions after a wildcard aren't known.
+	JoinedReturnedColumns map[int]string
+}
+
+// A JOIN that was added to the query, and the foreign key it joined on.
+type AddedJoin struct {
+	// Qualified name of the joined table.
+	Table string
+	// Set if the table was joined with a generated alias.
+	Alias      string
+	Constraint string
+	// True if the foreign key was declared in a relationships file, and isn't
+	// a real constraint.
+	Declared bool
+	// True if the foreign key was inferred from column names, and isn't a real
+	// constraint.
+	Inferred bool
+	// True if the join can match more than one row (ex: joining a child table
+	// from its parent).
+	ToMany bool
+	// True if the table is joined in a subquery that aggregates its columns.
+	Aggregated bool
+}
+
+func (j AddedJoin) String() string {
+	s := j.Table
+	if j.Alias != "" {
+		s += " AS " + j.Alias
+	}
+	s += " via " + j.Constraint
+	if j.Declared {
+		s += " (declared)"
+	} else if j.Inferred {
+		s += " (inferred)"
+	}
+	if j.Aggregated {
+		s += " (aggregated)"
+	} else if j.ToMany {
+		s += " (to-many)"
+	}
+	return s
 }
 
 // Attempts to add JOINs to queries that reference columns from other tables.
-func AddMissingJoinsToQuery(parsedQuery *pg_query.ParseResult, databaseInfo dbinfo.DatabaseInfo, joinBehavior JoinBehavior) (MissingJoinResult, error) {
-	var joinPlan MissingJoinResult
-	for _, stmt := range parsedQuery.GetStmts() {
+// Unqualified table names are resolved using the given search path, and paths
+// are scored using pathCost, or DefaultPathCost if it's nil.
+func AddMissingJoinsToQuery(parsedQuery *pg_query.ParseResult, databaseInfo dbinfo.DatabaseInfo, joinBehavior JoinBehavior, pathCost PathCost, searchPath []string) (MissingJoinResult, error) {
+	joinPlan := newMissingJoinResult()
+	if pathCost == nil {
+		pathCost = DefaultPathCost{}
+	}
+	for i, stmt := range parsedQuery.GetStmts() {
 		// We can only safely do this on SELECTs.
 		if stmt.Stmt.GetSelectStmt() == nil {
 			continue
 		}
-		tableMap, err := addMissingJoinsToSelect(stmt, databaseInfo, joinBehavior)
-		if err != nil {
-			return joinPlan, err
+		// Each SELECT in the statement (ex: CTEs and subqueries) is joined
+		// separately, so tables are joined where their columns are used.
+		// Outer scopes come first, so the tables joined into them are known
+		// when joining their subqueries.
+		joinedTables := map[*parse.Scope][]parse.QueryTable{}
+		for _, scope := range parse.BuildScopeTree(stmt.Stmt.GetSelectStmt()).Scopes() {
+			if len(scope.Stmt.FromClause) == 0 {
+				continue
+			}
+			scopeJoinPlan, err := addMissingJoinsToSelect(scope, joinedTables, databaseInfo, joinBehavior, pathCost, searchPath)
+			if err != nil {
+				return joinPlan, err
+			}
+			for _, join := range scopeJoinPlan.Joins {
+				// Aggregated tables are only in scope in their subquery.
+				if join.Aggregated {
+					continue
+				}
+				schema, name := dbinfo.SplitQualifiedName(join.Table)
+				table := parse.QueryTable{Schema: schema, Name: name}
+				if join.Alias != "" {
+					table.Alias = &join.Alias
+				}
+				joinedTables[scope] = append(joinedTables[scope], table)
+			}
+			if i > 0 {
+				clear(scopeJoinPlan.JoinedReturnedColumns)
+			}
+			joinPlan.merge(scopeJoinPlan)
 		}
-		joinPlan = tableMap
 	}
 	return joinPlan, nil
 }
 
-func addMissingJoinsToSelect(stmt *pg_query.RawStmt, databaseInfo dbinfo.DatabaseInfo, joinBehavior JoinBehavior) (MissingJoinResult, error) {
-	joinPlan := MissingJoinResult{
+func newMissingJoinResult() MissingJoinResult {
+	return MissingJoinResult{
 		MissingColumnsToJoinedTables:   map[string]string{},
 		MissingColumnsToPossibleTables: map[string]map[string]string{},
+		Joins:                          []AddedJoin{},
+		JoinedAliases:                  map[string]string{},
+		JoinedReturnedColumns:          map[int]string{},
 	}
+}
 
-	// Parse the query.
-	query := parse.TraverseQuery(stmt, 0)
+func (r *MissingJoinResult) merge(other MissingJoinResult) {
+	maps.Copy(r.MissingColumnsToJoinedTables, other.MissingColumnsToJoinedTables)
+	for column, tables := range other.MissingColumnsToPossibleTables {
+		if _, ok := r.MissingColumnsToPossibleTables[column]; !ok {
+			r.MissingColumnsToPossibleTables[column] = map[string]string{}
+		}
+		maps.Copy(r.MissingColumnsToPossibleTables[column], tables)
+	}
+	r.Joins = append(r.Joins, other.Joins...)
+	maps.Copy(r.JoinedAliases, other.JoinedAliases)
+	maps.Copy(r.JoinedReturnedColumns, other.JoinedReturnedColumns)
+	r.MultipliesRows = r.MultipliesRows || other.MultipliesRows
+}
+
+// Tables already joined into outer scopes are in joinedTables, by scope.
+func addMissingJoinsToSelect(scope *parse.Scope, joinedTables map[*parse.Scope][]parse.QueryTable, databaseInfo dbinfo.DatabaseInfo, joinBehavior JoinBehavior, pathCost PathCost, searchPath []string) (MissingJoinResult, error) {
+	joinPlan := newMissingJoinResult()
+	query := scope.Query
+
+	// Table names are qualified from here on, unless they don't exist in the
+	// database.
+	resolveTable := func(tableName string) string {
+		qualifiedName, _ := databaseInfo.ResolveTable(tableName, searchPath)
+		return qualifiedName
+	}
 
 	// Set up some helpful maps for later.
 	queryTableNames := map[string]string{}
 	originalQueryTableNames := map[string]string{}
 	for _, table := range query.Tables {
-		queryTableNames[table.Name] = table.Name
-		originalQueryTableNames[table.Name] = table.Name
+		tableName := resolveTable(table.String())
+		queryTableNames[tableName] = tableName
+		originalQueryTableNames[tableName] = tableName
 	}
 
 	tableToAlias := map[string]string{}
 	aliasToTable := map[string]string{}
 	for _, table := range query.Tables {
+		tableName := resolveTable(table.String())
 		if table.Alias != nil {
-			tableToAlias[table.Name] = *table.Alias
-			aliasToTable[*table.Alias] = table.Name
+			tableToAlias[tableName] = *table.Alias
+			aliasToTable[*table.Alias] = tableName
+		} else {
+			// Unaliased tables are referred to by their relation name.
+			aliasToTable[table.Name] = tableName
+		}
+	}
+	// Tables from outer scopes (ex: in correlated subqueries) can be
+	// referenced, but not joined from.
+	outerTableNames := map[string]string{}
+	// Tables from outer scopes -> how they're referenced.
+	outerTableReferences := map[string]string{}
+	// CTEs and subqueries in FROM can be referenced, but aren't tables.
+	relationNames := map[string]bool{}
+	for name := range scope.Relations {
+		relationNames[name] = true
+	}
+	addOuterTable := func(table parse.QueryTable) {
+		tableName := resolveTable(table.String())
+		outerTableNames[tableName] = tableName
+		reference := table.Name
+		if table.Alias != nil {
+			reference = *table.Alias
+		}
+		if _, ok := aliasToTable[reference]; !ok {
+			aliasToTable[reference] = tableName
+		}
+		if _, ok := outerTableReferences[tableName]; !ok {
+			outerTableReferences[tableName] = reference
+		}
+	}
+	innerScope := scope
+	for _, outerScope := range scope.OuterScopes() {
+		for _, table := range outerScope.Tables {
+			addOuterTable(table)
 		}
+		// Subqueries in expressions (ex: WHERE EXISTS) can also reference
+		// tables joined into the outer FROM. LATERAL subqueries can't, since
+		// they could come before the join.
+		if innerScope.Type == parse.ScopeTypeSubLink {
+			for _, table := range joinedTables[outerScope] {
+				addOuterTable(table)
+			}
+		}
+		for name := range outerScope.Relations {
+			relationNames[name] = true
+		}
+		innerScope = outerScope
 	}
+	// Returns how a table in the query should be referenced in conditions.
 	aliasTable := func(tableName string) string {
 		aliasName, ok := tableToAlias[tableName]
 		if ok {
 			return aliasName
 		}
-		return tableName
+		_, name := dbinfo.SplitQualifiedName(tableName)
+		return name
 	}
 	unAliasTable := func(aliasName string) string {
 		tableName, ok := aliasToTable[aliasName]
 		if ok {
 			return tableName
 		}
-		return aliasName
+		return resolveTable(aliasName)
+	}
+	// Returns the first of alias, alias_2, alias_3, etc. that doesn't refer to
+	// another table or relation in the query.
+	uniqueAlias := func(alias string) string {
+		for suffix, baseAlias := 2, alias; ; suffix++ {
+			if _, aliasInUse := aliasToTable[alias]; !aliasInUse && !relationNames[alias] {
+				return alias
+			}
+			alias = fmt.Sprintf("%s_%d", baseAlias, suffix)
+		}
+	}
+	// Returns how a table should be referenced in a FROM/JOIN, only qualifying
+	// it if the search path would resolve its name to a different table.
+	tableReference := func(tableName string) string {
+		_, name := dbinfo.SplitQualifiedName(tableName)
+		if resolveTable(name) == tableName {
+			return name
+		}
+		return tableName
 	}
 
 	allPaths := [][]string{}
 	queryColumnsSorted := slices.Sorted(maps.Keys(query.Columns))
+
+	// Columns can be qualified with a chain of foreign key column or
+	// constraint names (ex: sender_id.email, or manager_id.manager_id.name) to
+	// pick which foreign keys their table is joined on. Each gets its own
+	// aliased join, so a table can be joined to itself.
+	roleJoins := []roleJoin{}
+	roleColumnAliases := map[string]string{}
+	roleJoinAliases := map[string]string{}
+	for _, columnKey := range queryColumnsSorted {
+		column := query.Columns[columnKey]
+		if column.Type == parse.QueryColumnTypeColumn || relationNames[*column.Alias] {
+			continue
+		}
+		if _, isTable := databaseInfo.ResolveTable(unAliasTable(*column.Alias), searchPath); isTable {
+			continue
+		}
+		joins, ok := findRoleJoins(databaseInfo, slices.Sorted(maps.Keys(originalQueryTableNames)), strings.Split(*column.Alias, "."), column.Name)
+		if !ok {
+			continue
+		}
+		fromReference := aliasTable(joins[0].FromTable)
+		for i, join := range joins {
+			// Columns qualified by the same foreign keys share a join.
+			joinKey := fromReference + "." + join.Constraint
+			alias, ok := roleJoinAliases[joinKey]
+			if !ok {
+				// Aliases are named after the table and foreign key, ex:
+				// employees_manager, then employees_manager_manager.
+				alias = fromReference + "_" + join.Name
+				if i == 0 {
+					_, name := dbinfo.SplitQualifiedName(join.ToTable)
+					alias = name + "_" + join.Name
+				}
+				alias = uniqueAlias(alias)
+				join.FromReference = fromReference
+				join.Alias = alias
+				roleJoins = append(roleJoins, join)
+				roleJoinAliases[joinKey] = alias
+				aliasToTable[alias] = join.ToTable
+				joinPlan.JoinedAliases[alias] = join.ToTable
+			}
+			fromReference = alias
+		}
+		slog.Debug(fmt.Sprintf("Using %s to join %s for %s", fromReference, joins[len(joins)-1].ToTable, column))
+		roleColumnAliases[columnKey] = fromReference
+		joinPlan.MissingColumnsToJoinedTables[column.Name] = joins[len(joins)-1].ToTable
+	}
+
+	// ORDER BY refers to the names of returned columns before table columns
+	// (ex: SELECT count(*) AS total ... ORDER BY total), and GROUP BY refers
+	// to them if no table in FROM has that column (ex: GROUP BY day). These
+	// references aren't joined or qualified.
+	outputNames := map[string]bool{}
+	for _, target := range scope.Stmt.TargetList {
+		if resTarget := target.GetResTarget(); resTarget != nil && resTarget.Name != "" {
+			outputNames[resTarget.Name] = true
+		}
+	}
+	isInputColumn := func(name string) bool {
+		for tableName := range originalQueryTableNames {
+			if table, ok := databaseInfo.Tables[tableName]; ok && slices.Contains(table.Columns, name) {
+				return true
+			}
+		}
+		return scope.RelationHasColumn(name)
+	}
+	outputNameRefs := map[*pg_query.ColumnRef]bool{}
+	addOutputNameRef := func(node *pg_query.Node, canBeInputColumn bool) {
+		ref := node.GetColumnRef()
+		if ref == nil || len(ref.Fields) != 1 || ref.Fields[0].GetString_() == nil {
+			return
+		}
+		name := ref.Fields[0].GetString_().Sval
+		if outputNames[name] && (canBeInputColumn || !isInputColumn(name)) {
+			outputNameRefs[ref] = true
+		}
+	}
+	for _, node := range scope.Stmt.SortClause {
+		if sortBy := node.GetSortBy(); sortBy != nil {
+			addOutputNameRef(sortBy.Node, true)
+		}
+	}
+	for _, node := range scope.Stmt.GroupClause {
+		addOutputNameRef(node, false)
+	}
+
+	// Unqualified columns that are only used as the name of a returned column.
+	outputOnlyColumns := map[string]bool{}
+	for name := range outputNames {
+		outputOnlyColumns[name] = true
+	}
+	scope.VisitColumnRefs(func(ref *pg_query.ColumnRef) {
+		if len(ref.Fields) == 1 && !outputNameRefs[ref] && ref.Fields[0].GetString_() != nil {
+			delete(outputOnlyColumns, ref.Fields[0].GetString_().Sval)
+		}
+	})
+
+	adjacencyMap, err := databaseInfo.RelationshipGraph.AdjacencyMap()
+	if err != nil {
+		return joinPlan, err
+	}
+	// Tables that unqualified columns were found in.
+	columnTables := map[string]string{}
+	// Unqualified columns from outer scopes -> how their table is referenced.
+	outerColumnReferences := map[string]string{}
+	// Aggregated joins, keyed by their first join, in the order they're found.
+	aggregateJoins := map[string]*aggregateJoin{}
+	aggregateJoinKeys := []string{}
+	// Aggregated table and column pairs -> the subquery they're selected from.
+	aggregatedColumns := map[[2]string]*aggregateJoin{}
+	// Find the tables that could have each column, and the columns that need
+	// a join to get them.
+	columnCandidates := map[string][]string{}
+	missingColumnKeys := []string{}
 	for _, columnKey := range queryColumnsSorted {
 		var tablesThatHaveColumn []string
 		column := query.Columns[columnKey]
+		if _, ok := roleColumnAliases[columnKey]; ok {
+			continue
+		}
+		if column.Type == parse.QueryColumnTypeColumn && outputOnlyColumns[column.Name] {
+			continue
+		}
 
 		// Get the table name from the column alias, if possible.
 		var aliasTableName *string
 		if column.Alias != nil {
+			if relationNames[*column.Alias] {
+				continue
+			}
 			aliasRef := unAliasTable(*column.Alias)
-			table, tableInQuery := queryTableNames[aliasRef]
 			// Alias is likely coming from an existing FROM/JOIN.
-			if tableInQuery {
-				// We should still prefix this column since it came from a new join.
-				_, tableInOriginalQuery := originalQueryTableNames[table]
-				if !tableInOriginalQuery {
-					joinPlan.MissingColumnsToJoinedTables[column.Name] = table
-				}
+			_, tableInQuery := queryTableNames[aliasRef]
+			if _, tableInOuterQuery := outerTableNames[aliasRef]; tableInQuery || tableInOuterQuery {
 				continue
 			}
 			aliasTableName = &aliasRef
@@ -111,10 +409,20 @@ func addMissingJoinsToSelect(stmt *pg_query.RawStmt, databaseInfo dbinfo.Databas
 			tablesThatHaveColumn = []string{*aliasTableName}
 		} else {
 			matches, ok := databaseInfo.ColumnToTable[column.Name]
-			if !ok {
+			if !ok && column.Type == parse.QueryColumnTypeColumn && scope.RelationHasColumn(column.Name) {
+				continue
+			} else if !ok {
 				return joinPlan, fmt.Errorf("could not find table with column %s, maybe the database schema changed?", column.Name)
 			}
 			tablesThatHaveColumn = slices.Clone(matches)
+			// Columns inherited from a parent table are only mapped to the
+			// parent, but can be selected from inheriting tables in the query.
+			for tableName := range queryTableNames {
+				table, ok := databaseInfo.Tables[tableName]
+				if ok && !slices.Contains(tablesThatHaveColumn, tableName) && slices.Contains(table.Columns, column.Name) {
+					tablesThatHaveColumn = append(tablesThatHaveColumn, tableName)
+				}
+			}
 			slices.Sort(tablesThatHaveColumn)
 		}
 
@@ -122,34 +430,44 @@ func addMissingJoinsToSelect(stmt *pg_query.RawStmt, databaseInfo dbinfo.Databas
 			slog.Debug(fmt.Sprintf("Using alias to imply join for %s", column))
 			tablesThatHaveColumn = []string{*aliasTableName}
 		}
-
-		// See if the column already exists in a table in the query, if so we can ignore.
-		columnExistsInQuery := false
-		for _, table := range tablesThatHaveColumn {
-			_, tableInQuery := queryTableNames[table]
-			if tableInQuery {
-				columnExistsInQuery = true
-				// We should still prefix this column since it came from a new join.
-				_, tableInOriginalQuery := originalQueryTableNames[table]
-				if !tableInOriginalQuery {
-					joinPlan.MissingColumnsToJoinedTables[column.Name] = table
-				}
-				break
+		// Unqualified columns can come from a CTE or subquery, or a table in
+		// an outer scope if there isn't one in this scope that has them.
+		if column.Type == parse.QueryColumnTypeColumn {
+			_, inQuery := firstTableInQuery(tablesThatHaveColumn, queryTableNames)
+			outerTableName, inOuterQuery := firstTableInQuery(tablesThatHaveColumn, outerTableNames)
+			inRelation := scope.RelationHasColumn(column.Name)
+			if !inQuery && inOuterQuery && !inRelation {
+				outerColumnReferences[column.Name] = outerTableReferences[outerTableName]
+			}
+			if !inQuery && (inOuterQuery || inRelation) {
+				continue
 			}
 		}
-		if columnExistsInQuery {
-			continue
-		}
+		columnCandidates[columnKey] = tablesThatHaveColumn
+		missingColumnKeys = append(missingColumnKeys, columnKey)
+	}
 
-		// We need to join. Find the shortest path from a table that has the column to a table that exists in the query.
-		shortestPath := []string{}
+	// Finds the cheapest path from a table in the query to a table that has
+	// the column.
+	findPath := func(column parse.QueryColumn, tablesThatHaveColumn []string) joinCandidate {
+		best := joinCandidate{}
 		queryTableNamesSorted := slices.Sorted(maps.Keys(queryTableNames))
 		for _, otherTableName := range tablesThatHaveColumn {
 			for _, queryTableName := range queryTableNamesSorted {
-				path, _ := graph.ShortestPath(databaseInfo.RelationshipGraph, queryTableName, otherTableName)
+				path, cost := cheapestPath(databaseInfo, adjacencyMap, pathCost, queryTableName, otherTableName, nil)
 				if len(path) == 0 {
 					continue
 				}
+				// A more expensive path that can't multiply rows is better.
+				if pathFansOut(databaseInfo, path) {
+					toOnePath, toOneCost := cheapestPath(databaseInfo, adjacencyMap, pathCost, queryTableName, otherTableName, func(tableName string, otherTableName string) bool {
+						return joinFansOut(databaseInfo, tableName, otherTableName)
+					})
+					if toOnePath != nil {
+						path, cost = toOnePath, toOneCost
+					}
+				}
+				fansOut := pathFansOut(databaseInfo, path)
 
 				// Add debug output to join plan.
 				_, ok := joinPlan.MissingColumnsToPossibleTables[column.Name]
@@ -159,21 +477,130 @@ func addMissingJoinsToSelect(stmt *pg_query.RawStmt, databaseInfo dbinfo.Databas
 				joinPlan.MissingColumnsToPossibleTables[column.Name][otherTableName] = otherTableName
 
 				_, isOriginalQueryTable := originalQueryTableNames[queryTableName]
-				if len(shortestPath) == 0 ||
-					len(path) < len(shortestPath) ||
+				if len(best.Path) == 0 ||
+					(best.FansOut && !fansOut) ||
+					(best.FansOut == fansOut && cost < best.Cost) ||
 					// Break ties if the path is coming from a table the user had in their original query.
-					(len(path) == len(shortestPath) && isOriginalQueryTable) {
-					shortestPath = path
+					(best.FansOut == fansOut && cost == best.Cost && isOriginalQueryTable) {
+					best = joinCandidate{Path: path, FansOut: fansOut, FromOriginalTable: isOriginalQueryTable, Cost: cost}
 				}
 			}
 		}
-		if len(shortestPath) == 0 {
-			slog.Debug(fmt.Sprintf("Cannot find shortest path for %s", column))
-			continue
+		return best
+	}
+
+	// Columns are joined one at a time, but rather than joining them in the
+	// order they're selected, the path with the lowest cost for each missing
+	// column it covers is picked first. Tables it adds can have other
+	// missing columns, so this approximates the cheapest set of joins for
+	// every column (a Steiner tree).
+	for len(missingColumnKeys) > 0 {
+		// See if the column already exists in a table in the query, if so we can ignore.
+		remainingColumnKeys := []string{}
+		for _, columnKey := range missingColumnKeys {
+			column := query.Columns[columnKey]
+			if tableName, ok := firstTableInQuery(columnCandidates[columnKey], queryTableNames); ok {
+				if column.Type == parse.QueryColumnTypeColumn {
+					columnTables[column.Name] = tableName
+				}
+				// We should still prefix this column since it came from a new join.
+				if _, tableInOriginalQuery := originalQueryTableNames[tableName]; !tableInOriginalQuery {
+					joinPlan.MissingColumnsToJoinedTables[column.Name] = tableName
+				}
+				continue
+			}
+			remainingColumnKeys = append(remainingColumnKeys, columnKey)
+		}
+		missingColumnKeys = remainingColumnKeys
+
+		// We need to join. Find the best path for every missing column, then
+		// join the one that covers the most columns for the fewest joins.
+		var best *joinCandidate
+		remainingColumnKeys = []string{}
+		for _, columnKey := range missingColumnKeys {
+			column := query.Columns[columnKey]
+			candidate := findPath(column, columnCandidates[columnKey])
+			if len(candidate.Path) == 0 {
+				slog.Debug(fmt.Sprintf("Cannot find shortest path for %s", column))
+				continue
+			}
+			remainingColumnKeys = append(remainingColumnKeys, columnKey)
+			candidate.ColumnKey = columnKey
+			// Aggregated tables are joined in a subquery, so only the tables
+			// before them can have other columns.
+			joinedPath := candidate.Path
+			if index := firstFanOut(databaseInfo, candidate.Path); joinBehavior == JoinBehaviorAggregate && index != -1 && column.Type != parse.QueryColumnTypeTableWildcard {
+				joinedPath = candidate.Path[:index]
+			}
+			joinedTableNames := map[string]string{}
+			for _, pathTableName := range joinedPath {
+				joinedTableNames[pathTableName] = pathTableName
+			}
+			candidate.CoveredColumns = 1
+			for _, otherColumnKey := range missingColumnKeys {
+				if otherColumnKey == columnKey {
+					continue
+				}
+				if _, ok := firstTableInQuery(columnCandidates[otherColumnKey], joinedTableNames); ok {
+					candidate.CoveredColumns++
+				}
+			}
+			if best == nil || candidate.betterThan(*best) {
+				best = &candidate
+			}
+		}
+		missingColumnKeys = remainingColumnKeys
+		if best == nil {
+			break
+		}
+		missingColumnKeys = slices.DeleteFunc(missingColumnKeys, func(columnKey string) bool {
+			return columnKey == best.ColumnKey
+		})
+
+		column := query.Columns[best.ColumnKey]
+		shortestPath := best.Path
+		slog.Debug(fmt.Sprintf("Shortest path for %s is %s", column, strings.Join(shortestPath, ", ")))
+		index := firstFanOut(databaseInfo, shortestPath)
+		aggregated := joinBehavior == JoinBehaviorAggregate && index != -1 && column.Type != parse.QueryColumnTypeTableWildcard
+		// Recursive terms are evaluated once per iteration, so rows multiplied
+		// there would be multiplied again by every iteration after.
+		if scope.Type == parse.ScopeTypeRecursiveTerm && index != -1 && !aggregated {
+			return joinPlan, fmt.Errorf("could not join %s in the recursive term of %s, since joining %s can multiply rows", column, scope.Name, shortestPath[index])
+		}
+		// Everything after the first to-many join is aggregated in a
+		// subquery, and the rest is joined like usual. Columns share a
+		// subquery with columns joined through the same to-many joins, so
+		// their arrays don't multiply each other.
+		if aggregated {
+			aggregatedPath := shortestPath[index-1:]
+			toManyPath := aggregatedPath[:lastFanOut(databaseInfo, aggregatedPath)+1]
+			key := strings.Join(toManyPath, " ")
+			aggregate, ok := aggregateJoins[key]
+			if !ok {
+				aggregate = &aggregateJoin{Path: toManyPath}
+				aggregateJoins[key] = aggregate
+				aggregateJoinKeys = append(aggregateJoinKeys, key)
+			}
+			aggregate.Paths = append(aggregate.Paths, aggregatedPath)
+			tableColumn := [2]string{shortestPath[len(shortestPath)-1], column.Name}
+			aggregatedColumns[tableColumn] = aggregate
+			aggregate.Columns = append(aggregate.Columns, tableColumn)
+			joinPlan.MissingColumnsToJoinedTables[column.Name] = shortestPath[len(shortestPath)-1]
+			if column.Type == parse.QueryColumnTypeColumn {
+				columnTables[column.Name] = shortestPath[len(shortestPath)-1]
+			}
+			if index > 1 {
+				allPaths = append(allPaths, shortestPath[:index])
+			}
+			for _, pathTableName := range shortestPath[:index] {
+				queryTableNames[pathTableName] = pathTableName
+			}
 		} else {
-			slog.Debug(fmt.Sprintf("Shortest path for %s is %s", column, strings.Join(shortestPath, ", ")))
 			allPaths = append(allPaths, shortestPath)
 			joinPlan.MissingColumnsToJoinedTables[column.Name] = shortestPath[len(shortestPath)-1]
+			if column.Type == parse.QueryColumnTypeColumn {
+				columnTables[column.Name] = shortestPath[len(shortestPath)-1]
+			}
 			// Update queryTableNames so that sub-paths (JOINs) are never duplicated.
 			for _, pathTableName := range shortestPath {
 				queryTableNames[pathTableName] = pathTableName
@@ -181,7 +608,84 @@ func addMissingJoinsToSelect(stmt *pg_query.RawStmt, databaseInfo dbinfo.Databas
 		}
 	}
 
-	// Add joins to the parsed query.
+	// It's much easier parse a dummy query into an AST than constructing an AST ourselves.
+	// If this is extremely unperformant we can construct an AST, maybe from JSON/protobuf.
+	// Tables (by how they're referenced) that were left joined, so joins from
+	// them can't be inner joins without dropping rows.
+	leftJoinedReferences := map[string]bool{}
+	// Automatic joins are only inner joins when following a real foreign key
+	// with NOT NULL columns, from a table that wasn't left joined.
+	chooseJoin := func(fkeyTableName string, fkey *dbinfo.ForeignKey, fromReference string, fromForeignKeyTable bool) string {
+		switch joinBehavior {
+		case JoinBehaviorInnerJoin:
+			return "JOIN"
+		case JoinBehaviorAuto, JoinBehaviorAggregate:
+			if fromForeignKeyTable && !leftJoinedReferences[fromReference] && isRequiredForeignKey(databaseInfo.Tables[fkeyTableName], fkey) {
+				return "JOIN"
+			}
+		}
+		return "LEFT JOIN"
+	}
+	// Tables (by how they're referenced) -> the index of the FROM item they're
+	// in. Joins are added to the FROM item that has the table they're joined
+	// from, so that table is in scope for the join's conditions.
+	fromItems := map[string]int{}
+	for i, item := range scope.Stmt.FromClause {
+		for _, reference := range fromItemReferences(item) {
+			if _, ok := fromItems[reference]; !ok {
+				fromItems[reference] = i
+			}
+		}
+		for _, reference := range outerJoinedReferences(item) {
+			leftJoinedReferences[reference] = true
+		}
+	}
+	addJoin := func(fromReference string, joinReference string, joinStr string, joinTableReference string, conditions []string) error {
+		joinQuery := fmt.Sprintf("select placeholder FROM foo %s %s ON %s", joinStr, joinTableReference, strings.Join(conditions, " AND "))
+		joinParsed, err := pg_query.Parse(joinQuery)
+		if err != nil {
+			return err
+		}
+		index := fromItems[fromReference]
+		// Wrap the existing FROM item with the new join.
+		joinParsed.Stmts[0].Stmt.GetSelectStmt().FromClause[0].GetJoinExpr().Larg = scope.Stmt.FromClause[index]
+		// Replace the existing FROM item with the wrapped one.
+		scope.Stmt.FromClause[index] = joinParsed.Stmts[0].Stmt.GetSelectStmt().FromClause[0]
+		fromItems[joinReference] = index
+		return nil
+	}
+
+	// Add joins to the parsed query, starting with joins for columns
+	// qualified by foreign keys.
+	for _, join := range roleJoins {
+		matchingFkey := databaseInfo.Tables[join.ForeignKeyTable()].ForeignKeys[join.Constraint]
+		fkeyReference, toReference := join.FromReference, join.Alias
+		if join.Reverse {
+			fkeyReference, toReference = join.Alias, join.FromReference
+		}
+		conditions := []string{}
+		for _, fromToPair := range matchingFkey.ColumnConditions {
+			conditions = append(conditions, fmt.Sprintf("%s.%s = %s.%s", fkeyReference, fromToPair[0], toReference, fromToPair[1]))
+		}
+		toMany := join.Reverse && !databaseInfo.Tables[join.ToTable].IsUnique(foreignKeyColumns(matchingFkey))
+		joinStr := chooseJoin(join.ForeignKeyTable(), matchingFkey, join.FromReference, !join.Reverse)
+		leftJoinedReferences[join.Alias] = joinStr == "LEFT JOIN"
+		err := addJoin(join.FromReference, join.Alias, joinStr, tableReference(join.ToTable)+" "+join.Alias, conditions)
+		if err != nil {
+			return joinPlan, err
+		}
+		joinPlan.Joins = append(joinPlan.Joins, AddedJoin{
+			Table:      join.ToTable,
+			Alias:      join.Alias,
+			Constraint: join.Constraint,
+			Declared:   matchingFkey.Declared,
+			Inferred:   matchingFkey.Inferred,
+			ToMany:     toMany,
+		})
+		joinPlan.MultipliesRows = joinPlan.MultipliesRows || toMany
+	}
+
+	joinedAliases := map[string]string{}
 	for _, path := range allPaths {
 		lastTable := ""
 		for _, tableName := range path {
@@ -191,54 +695,546 @@ func addMissingJoinsToSelect(stmt *pg_query.RawStmt, databaseInfo dbinfo.Databas
 			}
 			// See what direction we need to join.
 			// @todo this could probably be stored in the graph, then allPaths would be vertexes not names.
-			var fromTable string
-			var matchingFkey *dbinfo.ForeignKey
-			for _, fkey := range databaseInfo.Tables[lastTable].ForeignKeys {
-				if fkey.ToTable == tableName {
-					matchingFkey = fkey
-					fromTable = lastTable
-					break
-				}
-			}
-			if matchingFkey == nil {
-				for _, fkey := range databaseInfo.Tables[tableName].ForeignKeys {
-					if fkey.ToTable == lastTable {
-						matchingFkey = fkey
-						fromTable = tableName
-						break
-					}
-				}
-			}
+			fromTable, constraintName, matchingFkey := findForeignKey(databaseInfo, lastTable, tableName)
 			if matchingFkey == nil {
 				return joinPlan, fmt.Errorf("could not find matching foreign key for %s <=> %s", lastTable, tableName)
 			}
+			// Reuse the join for a column qualified by the same foreign key.
+			roleJoinAlias, ok := roleJoinAliases[aliasTable(lastTable)+"."+constraintName]
+			if ok && joinPlan.JoinedAliases[roleJoinAlias] == tableName {
+				tableToAlias[tableName] = roleJoinAlias
+				lastTable = tableName
+				continue
+			}
 
-			// It's much easier parse a dummy query into an AST than constructing an AST ourselves.
-			// If this is extremely unperformant we can construct an AST, maybe from JSON/protobuf.
-			var joinStr string
-			if joinBehavior == JoinBehaviorInnerJoin {
-				joinStr = "JOIN"
+			// Joined tables can't share a name with another table in the query
+			// (ex: public.users and auth.users), so alias those by schema. They
+			// also can't hide the same table in an outer scope, so alias those
+			// with a suffix (ex: users_2).
+			joinTableReference := tableReference(tableName)
+			_, name := dbinfo.SplitQualifiedName(tableName)
+			_, tableInOuterQuery := outerTableNames[tableName]
+			if otherTableName, ok := aliasToTable[name]; ok && (otherTableName != tableName || tableInOuterQuery) {
+				alias := name
+				if otherTableName != tableName {
+					alias = strings.ReplaceAll(tableName, ".", "_")
+				}
+				alias = uniqueAlias(alias)
+				tableToAlias[tableName] = alias
+				aliasToTable[alias] = tableName
+				joinedAliases[tableName] = alias
+				joinPlan.JoinedAliases[alias] = tableName
+				joinTableReference += " " + alias
 			} else {
-				joinStr = "LEFT JOIN"
+				aliasToTable[name] = tableName
 			}
-			joinQuery := fmt.Sprintf("select placeholder FROM foo %s %s ON ", joinStr, aliasTable(tableName))
 			conditions := []string{}
 			for _, fromToPair := range matchingFkey.ColumnConditions {
 				conditions = append(conditions, fmt.Sprintf("%s.%s = %s.%s", aliasTable(fromTable), fromToPair[0], aliasTable(matchingFkey.ToTable), fromToPair[1]))
 			}
-			joinQuery += strings.Join(conditions, " AND ")
-			joinParsed, err := pg_query.Parse(joinQuery)
+			toMany := fromTable != lastTable && !databaseInfo.Tables[fromTable].IsUnique(foreignKeyColumns(matchingFkey))
+			joinStr := chooseJoin(fromTable, matchingFkey, aliasTable(lastTable), fromTable == lastTable)
+			leftJoinedReferences[aliasTable(tableName)] = joinStr == "LEFT JOIN"
+			err := addJoin(aliasTable(lastTable), aliasTable(tableName), joinStr, joinTableReference, conditions)
 			if err != nil {
 				return joinPlan, err
 			}
-			// Wrap existing from clause with the new join.
-			joinParsed.Stmts[0].Stmt.GetSelectStmt().FromClause[0].GetJoinExpr().Larg = stmt.Stmt.GetSelectStmt().FromClause[0]
-			// Replace existing from clause with wrapped from clause.
-			stmt.Stmt.GetSelectStmt().FromClause[0] = joinParsed.Stmts[0].Stmt.GetSelectStmt().FromClause[0]
+			joinPlan.Joins = append(joinPlan.Joins, AddedJoin{
+				Table:      tableName,
+				Constraint: constraintName,
+				Declared:   matchingFkey.Declared,
+				Inferred:   matchingFkey.Inferred,
+				ToMany:     toMany,
+			})
+			joinPlan.MultipliesRows = joinPlan.MultipliesRows || toMany
 			// The next join will be from this table.
 			lastTable = tableName
 		}
 	}
 
+	// Aggregated columns are selected from a LATERAL subquery after the tables
+	// it references are joined, ex:
+	// LEFT JOIN LATERAL (SELECT array_agg(avatars.image_url) AS image_url FROM avatars WHERE avatars.user_id = users.id) avatars ON true
+	// Subqueries are aliased by the name of their last to-many table, or by
+	// schema if another table or subquery in the query has that name (like
+	// joined tables). Tables joined to-one after it are left joined, so they
+	// don't drop rows from the arrays.
+	for _, key := range aggregateJoinKeys {
+		aggregate := aggregateJoins[key]
+		fromTableName, aliasTableName := aggregate.Path[0], aggregate.Path[len(aggregate.Path)-1]
+		_, name := dbinfo.SplitQualifiedName(aliasTableName)
+		alias := name
+		if _, ok := aliasToTable[name]; ok || relationNames[name] {
+			alias = uniqueAlias(strings.ReplaceAll(aliasTableName, ".", "_"))
+			joinPlan.JoinedAliases[alias] = aliasTableName
+		}
+		aliasToTable[alias] = aliasTableName
+		aggregate.Alias = alias
+		// Tables in the subquery are referenced by name, since they're in their
+		// own scope, unless that would hide the table it's joined from.
+		subqueryAliases := map[string]string{}
+		subqueryReference := func(tableName string) string {
+			if tableName == fromTableName {
+				return aliasTable(tableName)
+			}
+			if alias, ok := subqueryAliases[tableName]; ok {
+				return alias
+			}
+			_, name := dbinfo.SplitQualifiedName(tableName)
+			return name
+		}
+		subqueryTableReference := func(tableName string) string {
+			_, name := dbinfo.SplitQualifiedName(tableName)
+			if name != aliasTable(fromTableName) {
+				return tableReference(tableName)
+			}
+			subqueryAliases[tableName] = strings.ReplaceAll(tableName, ".", "_")
+			return tableReference(tableName) + " " + subqueryAliases[tableName]
+		}
+
+		fromClause := ""
+		whereConditions := []string{}
+		subqueryTableNames := map[string]bool{}
+		for _, path := range aggregate.Paths {
+			for i := 1; i < len(path); i++ {
+				if subqueryTableNames[path[i]] {
+					continue
+				}
+				subqueryTableNames[path[i]] = true
+				fromTable, constraintName, matchingFkey := findForeignKey(databaseInfo, path[i-1], path[i])
+				if matchingFkey == nil {
+					return joinPlan, fmt.Errorf("could not find matching foreign key for %s <=> %s", path[i-1], path[i])
+				}
+				joinTableReference := subqueryTableReference(path[i])
+				conditions := []string{}
+				for _, fromToPair := range matchingFkey.ColumnConditions {
+					conditions = append(conditions, fmt.Sprintf("%s.%s = %s.%s", subqueryReference(fromTable), fromToPair[0], subqueryReference(matchingFkey.ToTable), fromToPair[1]))
+				}
+				if i == 1 {
+					fromClause = joinTableReference
+					whereConditions = conditions
+				} else {
+					joinStr := "JOIN"
+					if i >= len(aggregate.Path) {
+						joinStr = "LEFT JOIN"
+					}
+					fromClause += fmt.Sprintf(" %s %s ON %s", joinStr, joinTableReference, strings.Join(conditions, " AND "))
+				}
+				addedJoin := AddedJoin{
+					Table:      path[i],
+					Constraint: constraintName,
+					Declared:   matchingFkey.Declared,
+					Inferred:   matchingFkey.Inferred,
+					ToMany:     fromTable != path[i-1] && !databaseInfo.Tables[fromTable].IsUnique(foreignKeyColumns(matchingFkey)),
+					Aggregated: true,
+				}
+				if path[i] == aliasTableName && alias != name {
+					addedJoin.Alias = alias
+				}
+				joinPlan.Joins = append(joinPlan.Joins, addedJoin)
+			}
+		}
+		// Each column is selected as its name, or prefixed with its table if
+		// another table has a column with the same name (ex: images_label).
+		targets := []string{}
+		aggregate.ColumnAliases = map[[2]string]string{}
+		targetNames := map[string]bool{}
+		for _, tableColumn := range aggregate.Columns {
+			if _, ok := aggregate.ColumnAliases[tableColumn]; ok {
+				continue
+			}
+			targetName := tableColumn[1]
+			if targetNames[targetName] {
+				_, name := dbinfo.SplitQualifiedName(tableColumn[0])
+				targetName = name + "_" + tableColumn[1]
+			}
+			for suffix, baseTargetName := 2, targetName; targetNames[targetName]; suffix++ {
+				targetName = fmt.Sprintf("%s_%d", baseTargetName, suffix)
+			}
+			targetNames[targetName] = true
+			aggregate.ColumnAliases[tableColumn] = targetName
+			targets = append(targets, fmt.Sprintf("array_agg(%s.%s) AS %s", subqueryReference(tableColumn[0]), tableColumn[1], targetName))
+		}
+		subquery := fmt.Sprintf("LATERAL (SELECT %s FROM %s WHERE %s) %s", strings.Join(targets, ", "), fromClause, strings.Join(whereConditions, " AND "), alias)
+		err := addJoin(aliasTable(fromTableName), alias, "LEFT JOIN", subquery, []string{"true"})
+		if err != nil {
+			return joinPlan, err
+		}
+	}
+
+	// Columns qualified by an aggregated table are selected from its subquery.
+	// Aggregated columns are arrays, so they can only be selected, not used
+	// in other clauses (ex: WHERE image_url = 'me.png') or aggregated again
+	// (ex: count(image_url) would count arrays, not rows).
+	var aggregatedRefErr error
+	aggregatedRef := func(ref *pg_query.ColumnRef, tableName string, aggregate *aggregateJoin) {
+		if !scope.TargetColumnRefs[ref] || scope.AggregateColumnRefs[ref] {
+			column := ref.Fields[len(ref.Fields)-1].GetString_().GetSval()
+			if qualifier := parse.ColumnRefQualifier(ref); qualifier != "" {
+				column = qualifier + "." + column
+			}
+			if aggregatedRefErr == nil {
+				aggregatedRefErr = fmt.Errorf("could not use %s outside of the SELECT list or in an aggregate, since it's aggregated into an array", column)
+			}
+			return
+		}
+		columnName := ref.Fields[len(ref.Fields)-1].GetString_().GetSval()
+		ref.Fields = []*pg_query.Node{pg_query.MakeStrNode(aggregate.Alias), pg_query.MakeStrNode(aggregate.ColumnAliases[[2]string{tableName, columnName}])}
+	}
+	scope.VisitColumnRefs(func(ref *pg_query.ColumnRef) {
+		qualifier := parse.ColumnRefQualifier(ref)
+		tableName := unAliasTable(qualifier)
+		_, tableInQuery := queryTableNames[tableName]
+		columnName := ref.Fields[len(ref.Fields)-1].GetString_().GetSval()
+		if aggregate, ok := aggregatedColumns[[2]string{tableName, columnName}]; ok && qualifier != "" && !tableInQuery {
+			aggregatedRef(ref, tableName, aggregate)
+		}
+	})
+	if aggregatedRefErr != nil {
+		return joinPlan, aggregatedRefErr
+	}
+	// Schema-qualified columns can't refer to aliased tables, so use the alias.
+	// Columns qualified by foreign keys refer to their join's alias. If joins
+	// were added, unqualified columns are qualified with the table they were
+	// found in, since the new tables could have columns with the same name.
+	scope.VisitColumnRefs(func(ref *pg_query.ColumnRef) {
+		qualifier := parse.ColumnRefQualifier(ref)
+		lastField := ref.Fields[len(ref.Fields)-1]
+		columnName := "*"
+		if lastField.GetString_() != nil {
+			columnName = lastField.GetString_().Sval
+		} else if lastField.GetAStar() == nil {
+			return
+		}
+		if alias, ok := joinedAliases[qualifier]; ok {
+			ref.Fields = []*pg_query.Node{pg_query.MakeStrNode(alias), lastField}
+		} else if alias, ok := roleColumnAliases[qualifier+"."+columnName]; ok {
+			ref.Fields = []*pg_query.Node{pg_query.MakeStrNode(alias), lastField}
+		} else if len(ref.Fields) > 1 || len(joinPlan.Joins) == 0 || outputNameRefs[ref] {
+			return
+		} else if tableName, ok := columnTables[columnName]; ok {
+			if aggregate, ok := aggregatedColumns[[2]string{tableName, columnName}]; ok {
+				aggregatedRef(ref, tableName, aggregate)
+				return
+			}
+			ref.Fields = []*pg_query.Node{pg_query.MakeStrNode(aliasTable(tableName)), lastField}
+		} else if reference, ok := outerColumnReferences[columnName]; ok {
+			ref.Fields = []*pg_query.Node{pg_query.MakeStrNode(reference), lastField}
+		}
+	})
+	if aggregatedRefErr != nil {
+		return joinPlan, aggregatedRefErr
+	}
+
+	// Note which joined table each of the statement's returned columns came
+	// from, so they can be told apart (ex: created_by.email and
+	// updated_by.email). Columns given a name aren't included.
+	if scope.Type == parse.ScopeTypeSelect {
+		for i, target := range scope.Stmt.TargetList {
+			resTarget := target.GetResTarget()
+			if resTarget == nil {
+				break
+			}
+			ref := resTarget.Val.GetColumnRef()
+			if ref != nil && ref.Fields[len(ref.Fields)-1].GetAStar() != nil {
+				break
+			}
+			if ref == nil || resTarget.Name != "" {
+				continue
+			}
+			qualifier := parse.ColumnRefQualifier(ref)
+			tableName := unAliasTable(qualifier)
+			_, tableInOriginalQuery := originalQueryTableNames[tableName]
+			_, tableInOuterQuery := outerTableNames[tableName]
+			if _, ok := joinPlan.JoinedAliases[qualifier]; ok {
+				joinPlan.JoinedReturnedColumns[i] = qualifier
+			} else if _, ok := databaseInfo.Tables[tableName]; ok && !tableInOriginalQuery && !tableInOuterQuery {
+				_, name := dbinfo.SplitQualifiedName(tableName)
+				joinPlan.JoinedReturnedColumns[i] = name
+			}
+		}
+	}
+
 	return joinPlan, nil
 }
+
+// Returns how the tables and subqueries in a FROM item are referenced,
+// including the ones in its JOINs.
+func fromItemReferences(node *pg_query.Node) []string {
+	switch {
+	case node.GetRangeVar() != nil:
+		rangeVar := node.GetRangeVar()
+		if rangeVar.Alias != nil {
+			return []string{rangeVar.Alias.Aliasname}
+		}
+		return []string{rangeVar.Relname}
+	case node.GetRangeSubselect() != nil:
+		if alias := node.GetRangeSubselect().Alias; alias != nil {
+			return []string{alias.Aliasname}
+		}
+	case node.GetRangeFunction() != nil:
+		if alias := node.GetRangeFunction().Alias; alias != nil {
+			return []string{alias.Aliasname}
+		}
+	case node.GetJoinExpr() != nil:
+		joinExpr := node.GetJoinExpr()
+		return append(fromItemReferences(joinExpr.Larg), fromItemReferences(joinExpr.Rarg)...)
+	}
+	return nil
+}
+
+// Returns how the tables in a FROM item that can be NULL because of an outer
+// join (ex: the right side of a LEFT JOIN) are referenced.
+func outerJoinedReferences(node *pg_query.Node) []string {
+	joinExpr := node.GetJoinExpr()
+	if joinExpr == nil {
+		return nil
+	}
+	references := append(outerJoinedReferences(joinExpr.Larg), outerJoinedReferences(joinExpr.Rarg)...)
+	if joinExpr.Jointype == pg_query.JoinType_JOIN_RIGHT || joinExpr.Jointype == pg_query.JoinType_JOIN_FULL {
+		references = append(references, fromItemReferences(joinExpr.Larg)...)
+	}
+	if joinExpr.Jointype == pg_query.JoinType_JOIN_LEFT || joinExpr.Jointype == pg_query.JoinType_JOIN_FULL {
+		references = append(references, fromItemReferences(joinExpr.Rarg)...)
+	}
+	return references
+}
+
+// Finds the foreign key to join two tables on. Foreign keys marked with
+// "@autojoin prefer" are used first, then real constraints before declared or
+// inferred ones, then foreign keys from the first table, then the first by
+// constraint name.
+func findForeignKey(databaseInfo dbinfo.DatabaseInfo, tableName string, otherTableName string) (string, string, *dbinfo.ForeignKey) {
+	edgeForeignKeys := databaseInfo.ForeignKeysBetween(tableName, otherTableName)
+	rank := func(edgeForeignKey dbinfo.EdgeForeignKey) int {
+		fkey := databaseInfo.Tables[edgeForeignKey.Table].ForeignKeys[edgeForeignKey.Constraint]
+		rank := 0
+		if !fkey.Preferred {
+			rank += 4
+		}
+		if fkey.Declared || fkey.Inferred {
+			rank += 2
+		}
+		if edgeForeignKey.Table != tableName {
+			rank += 1
+		}
+		return rank
+	}
+	slices.SortStableFunc(edgeForeignKeys, func(a, b dbinfo.EdgeForeignKey) int {
+		return rank(a) - rank(b)
+	})
+	if len(edgeForeignKeys) == 0 {
+		return "", "", nil
+	}
+	edgeForeignKey := edgeForeignKeys[0]
+	return edgeForeignKey.Table, edgeForeignKey.Constraint, databaseInfo.Tables[edgeForeignKey.Table].ForeignKeys[edgeForeignKey.Constraint]
+}
+
+// Returns true if every row of a table has a row to join to using the foreign
+// key. Declared and inferred foreign keys aren't enforced, so they can't be
+// relied on.
+func isRequiredForeignKey(table *dbinfo.TableInfo, fkey *dbinfo.ForeignKey) bool {
+	if fkey.Declared || fkey.Inferred {
+		return false
+	}
+	for _, fromToPair := range fkey.ColumnConditions {
+		if !slices.Contains(table.NotNullColumns, fromToPair[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+func foreignKeyColumns(fkey *dbinfo.ForeignKey) []string {
+	columns := []string{}
+	for _, fromToPair := range fkey.ColumnConditions {
+		columns = append(columns, fromToPair[0])
+	}
+	return columns
+}
+
+// Returns true if joining from one table to another can match more than one
+// row, which is when the only foreign keys between them are from the other
+// table and aren't unique.
+func joinFansOut(databaseInfo dbinfo.DatabaseInfo, tableName string, otherTableName string) bool {
+	for _, edgeForeignKey := range databaseInfo.ForeignKeysBetween(tableName, otherTableName) {
+		fkey := databaseInfo.Tables[edgeForeignKey.Table].ForeignKeys[edgeForeignKey.Constraint]
+		if edgeForeignKey.Table == tableName || databaseInfo.Tables[edgeForeignKey.Table].IsUnique(foreignKeyColumns(fkey)) {
+			return false
+		}
+	}
+	return true
+}
+
+func pathFansOut(databaseInfo dbinfo.DatabaseInfo, path []string) bool {
+	return firstFanOut(databaseInfo, path) != -1
+}
+
+// Returns the index of the first table in a path that's joined to-many, or
+// -1 if every join is to-one.
+func firstFanOut(databaseInfo dbinfo.DatabaseInfo, path []string) int {
+	for i := 1; i < len(path); i++ {
+		if joinFansOut(databaseInfo, path[i-1], path[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the index of the last table in a path that's joined to-many, or
+// -1 if every join is to-one.
+func lastFanOut(databaseInfo dbinfo.DatabaseInfo, path []string) int {
+	for i := len(path) - 1; i > 0; i-- {
+		if joinFansOut(databaseInfo, path[i-1], path[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// A path that joins a missing column's table to the query.
+type joinCandidate struct {
+	ColumnKey string
+	Path      []string
+	// True if the path has a join that can multiply rows.
+	FansOut           bool
+	FromOriginalTable bool
+	// The cost of the path's joins, see PathCost.
+	Cost int
+	// The number of missing columns that the added tables have.
+	CoveredColumns int
+}
+
+// Paths that can't multiply rows are better, then paths with the lowest cost
+// per column they cover. Ties are broken by the path itself, so the
+// order columns are selected in doesn't matter.
+func (c joinCandidate) betterThan(other joinCandidate) bool {
+	if c.FansOut != other.FansOut {
+		return !c.FansOut
+	}
+	if cost, otherCost := c.Cost*other.CoveredColumns, other.Cost*c.CoveredColumns; cost != otherCost {
+		return cost < otherCost
+	}
+	if c.CoveredColumns != other.CoveredColumns {
+		return c.CoveredColumns > other.CoveredColumns
+	}
+	if len(c.Path) != len(other.Path) {
+		return len(c.Path) < len(other.Path)
+	}
+	if c.FromOriginalTable != other.FromOriginalTable {
+		return c.FromOriginalTable
+	}
+	if path, otherPath := strings.Join(c.Path, " "), strings.Join(other.Path, " "); path != otherPath {
+		return path < otherPath
+	}
+	return c.ColumnKey < other.ColumnKey
+}
+
+// Returns the first of the given tables that's in the query.
+func firstTableInQuery(tableNames []string, queryTableNames map[string]string) (string, bool) {
+	for _, tableName := range tableNames {
+		if _, tableInQuery := queryTableNames[tableName]; tableInQuery {
+			return tableName, true
+		}
+	}
+	return "", false
+}
+
+// Tables joined in a subquery that aggregates their columns, starting with a
+// to-many join from a table in the query.
+type aggregateJoin struct {
+	// Path from the table in the query to the last to-many join.
+	Path []string
+	// Paths from the table in the query, through Path, to tables with
+	// aggregated columns.
+	Paths [][]string
+	// Qualified table name and column pairs to aggregate.
+	Columns [][2]string
+	// The subquery's alias.
+	Alias string
+	// Qualified table name and column pairs -> what the subquery selects them
+	// as.
+	ColumnAliases map[[2]string]string
+}
+
+// A join for a column qualified by a foreign key's column or constraint name
+// (its role), ex: the manager_id in manager_id.name.
+type roleJoin struct {
+	// Used to name the join's alias, ex: manager for manager_id.
+	Name       string
+	FromTable  string
+	ToTable    string
+	Constraint string
+	// True if the foreign key is from ToTable to FromTable.
+	Reverse bool
+	// How FromTable and ToTable are referenced in the query.
+	FromReference string
+	Alias         string
+}
+
+// Returns the qualified name of the table that has the foreign key.
+func (j roleJoin) ForeignKeyTable() string {
+	if j.Reverse {
+		return j.ToTable
+	}
+	return j.FromTable
+}
+
+// Finds the joins for a chain of roles, starting from a table in the query
+// and ending at a table with the given column.
+func findRoleJoins(databaseInfo dbinfo.DatabaseInfo, queryTableNames []string, roles []string, column string) ([]roleJoin, bool) {
+	for _, queryTableName := range queryTableNames {
+		for _, join := range findRoleForeignKeys(databaseInfo, queryTableName, roles[0]) {
+			if len(roles) > 1 {
+				joins, ok := findRoleJoins(databaseInfo, []string{join.ToTable}, roles[1:], column)
+				if ok {
+					return append([]roleJoin{join}, joins...), true
+				}
+			} else if column == "*" || slices.Contains(databaseInfo.Tables[join.ToTable].Columns, column) {
+				return []roleJoin{join}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Finds the foreign keys from a table with the given role, then the foreign
+// keys to it (ex: sender_id.body from users).
+func findRoleForeignKeys(databaseInfo dbinfo.DatabaseInfo, tableName string, role string) []roleJoin {
+	isRole := func(constraintName string, fkey *dbinfo.ForeignKey) bool {
+		return constraintName == role || (len(fkey.ColumnConditions) == 1 && fkey.ColumnConditions[0][0] == role)
+	}
+	// Joins are named after their column if possible, since constraint names
+	// are usually long.
+	joinName := func(constraintName string, fkey *dbinfo.ForeignKey) string {
+		if len(fkey.ColumnConditions) == 1 {
+			return strings.TrimSuffix(fkey.ColumnConditions[0][0], "_id")
+		}
+		return constraintName
+	}
+	isJoinable := func(tableName string) bool {
+		table, ok := databaseInfo.Tables[tableName]
+		return ok && !table.Ignored
+	}
+	joins := []roleJoin{}
+	if !isJoinable(tableName) {
+		return joins
+	}
+	table := databaseInfo.Tables[tableName]
+	for _, constraintName := range slices.Sorted(maps.Keys(table.ForeignKeys)) {
+		fkey := table.ForeignKeys[constraintName]
+		if isRole(constraintName, fkey) && isJoinable(fkey.ToTable) {
+			joins = append(joins, roleJoin{Name: joinName(constraintName, fkey), FromTable: tableName, ToTable: fkey.ToTable, Constraint: constraintName})
+		}
+	}
+	for _, otherTableName := range slices.Sorted(maps.Keys(databaseInfo.Tables)) {
+		otherTable := databaseInfo.Tables[otherTableName]
+		for _, constraintName := range slices.Sorted(maps.Keys(otherTable.ForeignKeys)) {
+			fkey := otherTable.ForeignKeys[constraintName]
+			if fkey.ToTable == tableName && isRole(constraintName, fkey) && isJoinable(otherTableName) {
+				joins = append(joins, roleJoin{Name: joinName(constraintName, fkey), FromTable: tableName, ToTable: otherTableName, Constraint: constraintName, Reverse: true})
+			}
+		}
+	}
+	return joins
+}
@@ -18,24 +18,98 @@ func normalizeString(s string) string {
 	return strings.TrimSpace(strings.ReplaceAll(strings.ReplaceAll(s, "\n", ""), "; ", ";"))
 }
 
-func runTestData(t *testing.T, ctx context.Context, tx pgx.Tx, testDir string) {
-	schemaFile, err := os.ReadFile(path.Join(testDir, "schema.sql"))
+// How queries are joined in tests. Zero values use inner joins and the
+// default path cost.
+type joinOptions struct {
+	JoinBehavior JoinBehavior
+	PathCost     PathCost
+}
+
+// Loads test schema from DDL, with the default search path.
+func loadDDL(t *testing.T, ddl string) (dbinfo.DatabaseInfo, []string) {
+	databaseInfo, err := dbinfo.GetDatabaseInfoFromDDL(ddl)
 	require.NoError(t, err)
-	queryBefore, err := os.ReadFile(path.Join(testDir, "query_before.sql"))
+	return databaseInfo, dbinfo.ParseSearchPath(dbinfo.DefaultSearchPath, "")
+}
+
+// Adds joins to a query and returns the deparsed result.
+func joinQuery(t *testing.T, databaseInfo dbinfo.DatabaseInfo, searchPath []string, opts joinOptions, query string) (string, MissingJoinResult, error) {
+	if opts.JoinBehavior == "" {
+		opts.JoinBehavior = JoinBehaviorInnerJoin
+	}
+	if opts.PathCost == nil {
+		opts.PathCost = DefaultPathCost{}
+	}
+	parsedQuery, err := pg_query.Parse(query)
 	require.NoError(t, err)
-	queryAfter, err := os.ReadFile(path.Join(testDir, "query_after.sql"))
+	joinPlan, err := AddMissingJoinsToQuery(parsedQuery, databaseInfo, opts.JoinBehavior, opts.PathCost, searchPath)
+	if err != nil {
+		return "", joinPlan, err
+	}
+	deparse, err := pg_query.Deparse(parsedQuery)
+	require.NoError(t, err)
+	return deparse, joinPlan, nil
+}
+
+// Asserts that joining a query results in the expected query.
+func assertJoined(t *testing.T, databaseInfo dbinfo.DatabaseInfo, searchPath []string, opts joinOptions, query string, expected string) {
+	t.Helper()
+	deparse, _, err := joinQuery(t, databaseInfo, searchPath, opts, query)
+	require.NoError(t, err, query)
+	require.Equal(t, expected, deparse)
+}
+
+// Asserts that joining a query returns an error.
+func assertJoinError(t *testing.T, databaseInfo dbinfo.DatabaseInfo, searchPath []string, opts joinOptions, query string, expectedError string) {
+	t.Helper()
+	_, _, err := joinQuery(t, databaseInfo, searchPath, opts, query)
+	require.ErrorContains(t, err, expectedError, query)
+}
+
+func testDataDirs(t *testing.T) []string {
+	_, filename, _, _ := runtime.Caller(0)
+	dir := path.Join(path.Dir(filename), "../../testdata")
+	dirEntry, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	testDirs := []string{}
+	for _, e := range dirEntry {
+		if e.IsDir() {
+			testDirs = append(testDirs, path.Join(dir, e.Name()))
+		}
+	}
+	return testDirs
+}
+
+func runTestData(t *testing.T, ctx context.Context, tx pgx.Tx, testDir string) {
+	schemaFile, err := os.ReadFile(path.Join(testDir, "schema.sql"))
 	require.NoError(t, err)
 
 	_, err = tx.Exec(ctx, string(schemaFile))
 	require.NoError(t, err)
 	databaseInfo, err := dbinfo.GetDatabaseInfoResult(ctx, tx)
 	require.NoError(t, err)
-	parsedQuery, err := pg_query.Parse(string(queryBefore))
+	searchPath, err := dbinfo.GetSearchPath(ctx, tx)
 	require.NoError(t, err)
-	_, err = AddMissingJoinsToQuery(parsedQuery, databaseInfo, JoinBehaviorInnerJoin)
+	runTestDataQueries(t, testDir, databaseInfo, searchPath)
+}
+
+func runTestDataQueries(t *testing.T, testDir string, databaseInfo dbinfo.DatabaseInfo, searchPath []string) {
+	// Test data can declare relationships that aren't real foreign keys.
+	relationshipsFile, err := os.Open(path.Join(testDir, "relationships.yaml"))
+	if err == nil {
+		defer relationshipsFile.Close()
+		relationships, err := dbinfo.LoadRelationships(relationshipsFile)
+		require.NoError(t, err)
+		require.NoError(t, databaseInfo.AddRelationships(relationships))
+	}
+
+	queryBefore, err := os.ReadFile(path.Join(testDir, "query_before.sql"))
+	require.NoError(t, err)
+	queryAfter, err := os.ReadFile(path.Join(testDir, "query_after.sql"))
 	require.NoError(t, err)
 
-	deparse, err := pg_query.Deparse(parsedQuery)
+	deparse, _, err := joinQuery(t, databaseInfo, searchPath, joinOptions{}, string(queryBefore))
 	require.NoError(t, err)
 	require.Equal(t, normalizeString(string(queryAfter)), normalizeString(deparse))
 }
@@ -52,19 +126,235 @@ func TestAutojoin(t *testing.T) {
 	}
 	defer conn.Close(ctx)
 
-	_, filename, _, _ := runtime.Caller(0)
-	dir := path.Join(path.Dir(filename), "../../testdata")
-	dirEntry, err := os.ReadDir(dir)
-	require.NoError(t, err)
-
-	for _, e := range dirEntry {
-		if !e.IsDir() {
-			continue
-		}
+	for _, testDir := range testDataDirs(t) {
 		tx, err := conn.Begin(ctx)
 		require.NoError(t, err)
-		runTestData(t, ctx, tx, path.Join(dir, e.Name()))
+		runTestData(t, ctx, tx, testDir)
 		err = tx.Rollback(ctx)
 		require.NoError(t, err)
 	}
 }
+
+// Runs the same test data without a database by loading schema.sql as DDL.
+func TestAutojoinOffline(t *testing.T) {
+	for _, testDir := range testDataDirs(t) {
+		schemaFile, err := os.ReadFile(path.Join(testDir, "schema.sql"))
+		require.NoError(t, err)
+		databaseInfo, err := dbinfo.GetDatabaseInfoFromDDL(string(schemaFile))
+		require.NoError(t, err)
+		runTestDataQueries(t, testDir, databaseInfo, dbinfo.ParseSearchPath(dbinfo.DefaultSearchPath, ""))
+	}
+}
+
+func TestJoinBehaviorAuto(t *testing.T) {
+	databaseInfo, searchPath := loadDDL(t, `
+		CREATE TABLE users (id INT PRIMARY KEY, email TEXT);
+		CREATE TABLE avatars (id INT PRIMARY KEY, image_url TEXT, user_id INT NOT NULL REFERENCES users(id));
+		CREATE TABLE teams (id INT PRIMARY KEY, team_name TEXT, owner_id INT NOT NULL REFERENCES users(id));
+		CREATE TABLE projects (id INT PRIMARY KEY, title TEXT, team_id INT NOT NULL REFERENCES teams(id));
+		CREATE TABLE tasks (id INT PRIMARY KEY, body TEXT, project_id INT REFERENCES projects(id));
+	`)
+
+	for _, test := range []struct {
+		query    string
+		expected string
+	}{
+		// NOT NULL foreign keys from child to parent are inner joins.
+		{"SELECT title, email FROM projects", "SELECT projects.title, users.email FROM projects JOIN teams ON projects.team_id = teams.id JOIN users ON teams.owner_id = users.id"},
+		// Nullable foreign keys are left joins, and so is everything after them.
+		{"SELECT body, team_name FROM tasks", "SELECT tasks.body, teams.team_name FROM tasks LEFT JOIN projects ON tasks.project_id = projects.id LEFT JOIN teams ON projects.team_id = teams.id"},
+		// Parent to child is a left join.
+		{"SELECT team_name, image_url FROM teams", "SELECT teams.team_name, avatars.image_url FROM teams JOIN users ON teams.owner_id = users.id LEFT JOIN avatars ON avatars.user_id = users.id"},
+		// Joins from tables the query already left joins are left joins.
+		{"SELECT title, email FROM projects LEFT JOIN teams ON teams.id = projects.team_id", "SELECT projects.title, users.email FROM projects LEFT JOIN teams ON teams.id = projects.team_id LEFT JOIN users ON teams.owner_id = users.id"},
+	} {
+		assertJoined(t, databaseInfo, searchPath, joinOptions{JoinBehavior: JoinBehaviorAuto}, test.query, test.expected)
+	}
+}
+
+func TestToManyJoins(t *testing.T) {
+	databaseInfo, searchPath := loadDDL(t, `
+		CREATE TABLE users (id INT PRIMARY KEY, email TEXT);
+		CREATE TABLE user_profiles (user_id INT UNIQUE REFERENCES users(id), bio TEXT);
+		CREATE TABLE avatars (id INT PRIMARY KEY, image_url TEXT, user_id INT REFERENCES users(id));
+	`)
+
+	_, joinPlan, err := joinQuery(t, databaseInfo, searchPath, joinOptions{}, "SELECT email, bio FROM users")
+	require.NoError(t, err)
+	require.False(t, joinPlan.MultipliesRows)
+	require.False(t, joinPlan.Joins[0].ToMany)
+
+	_, joinPlan, err = joinQuery(t, databaseInfo, searchPath, joinOptions{}, "SELECT email, bio, image_url FROM users")
+	require.NoError(t, err)
+	require.True(t, joinPlan.MultipliesRows)
+	require.Equal(t, "public.avatars via avatars_user_id_fkey (to-many)", joinPlan.Joins[1].String())
+
+	// Joining the parent is always to-one.
+	_, joinPlan, err = joinQuery(t, databaseInfo, searchPath, joinOptions{}, "SELECT image_url, email FROM avatars")
+	require.NoError(t, err)
+	require.False(t, joinPlan.MultipliesRows)
+}
+
+func TestJoinedReturnedColumns(t *testing.T) {
+	databaseInfo, searchPath := loadDDL(t, `
+		CREATE TABLE users (id INT PRIMARY KEY, email TEXT);
+		CREATE TABLE documents (id INT PRIMARY KEY, title TEXT, created_by INT NOT NULL REFERENCES users(id), updated_by INT REFERENCES users(id));
+	`)
+
+	// Each copy of a table joined more than once is referenced by its alias.
+	_, joinPlan, err := joinQuery(t, databaseInfo, searchPath, joinOptions{}, "SELECT title, created_by.email, updated_by.email AS editor, updated_by.email FROM documents")
+	require.NoError(t, err)
+	require.Equal(t, map[int]string{1: "users_created_by", 3: "users_updated_by"}, joinPlan.JoinedReturnedColumns)
+
+	_, joinPlan, err = joinQuery(t, databaseInfo, searchPath, joinOptions{}, "SELECT email, title FROM documents")
+	require.NoError(t, err)
+	require.Equal(t, map[int]string{0: "users"}, joinPlan.JoinedReturnedColumns)
+
+	// Positions after a wildcard aren't known.
+	_, joinPlan, err = joinQuery(t, databaseInfo, searchPath, joinOptions{}, "SELECT *, email FROM documents")
+	require.NoError(t, err)
+	require.Empty(t, joinPlan.JoinedReturnedColumns)
+}
+
+func TestJoinBehaviorAggregate(t *testing.T) {
+	databaseInfo, searchPath := loadDDL(t, `
+		CREATE TABLE teams (id INT PRIMARY KEY, team_name TEXT);
+		CREATE TABLE users (id INT PRIMARY KEY, email TEXT, team_id INT NOT NULL REFERENCES teams(id));
+		CREATE TABLE files (id INT PRIMARY KEY, file_name TEXT, label TEXT);
+		CREATE TABLE avatars (id INT PRIMARY KEY, image_url TEXT, label TEXT, user_id INT NOT NULL REFERENCES users(id), file_id INT NOT NULL REFERENCES files(id));
+		CREATE TABLE images (id INT PRIMARY KEY, width INT, label TEXT, avatar_id INT NOT NULL REFERENCES avatars(id));
+	`)
+
+	for _, test := range []struct {
+		query    string
+		expected string
+	}{
+		// To-one joins are joined as usual.
+		{"SELECT image_url, team_name FROM avatars", "SELECT avatars.image_url, teams.team_name FROM avatars JOIN users ON avatars.user_id = users.id JOIN teams ON users.team_id = teams.id"},
+		// To-many joins are aggregated, along with everything joined after them.
+		// Each to-many join gets its own subquery, so arrays don't multiply
+		// each other.
+		{"SELECT email, image_url, width FROM users", "SELECT users.email, avatars.image_url, images.width FROM users LEFT JOIN LATERAL (SELECT array_agg(avatars.image_url) AS image_url FROM avatars WHERE avatars.user_id = users.id) avatars ON true LEFT JOIN LATERAL (SELECT array_agg(images.width) AS width FROM avatars JOIN images ON images.avatar_id = avatars.id WHERE avatars.user_id = users.id) images ON true"},
+		// To-one joins after a to-many join share its subquery, and are left
+		// joins so they don't drop rows from its arrays.
+		{"SELECT email, image_url, file_name FROM users", "SELECT users.email, avatars.image_url, avatars.file_name FROM users LEFT JOIN LATERAL (SELECT array_agg(avatars.image_url) AS image_url, array_agg(files.file_name) AS file_name FROM avatars LEFT JOIN files ON avatars.file_id = files.id WHERE avatars.user_id = users.id) avatars ON true"},
+		// Columns with the same name in different tables are each selected.
+		{"SELECT email, avatars.label, files.label FROM users", "SELECT users.email, avatars.label, avatars.files_label FROM users LEFT JOIN LATERAL (SELECT array_agg(avatars.label) AS label, array_agg(files.label) AS files_label FROM avatars LEFT JOIN files ON avatars.file_id = files.id WHERE avatars.user_id = users.id) avatars ON true"},
+		{"SELECT email, avatars.label, images.label FROM users", "SELECT users.email, avatars.label, images.label FROM users LEFT JOIN LATERAL (SELECT array_agg(avatars.label) AS label FROM avatars WHERE avatars.user_id = users.id) avatars ON true LEFT JOIN LATERAL (SELECT array_agg(images.label) AS label FROM avatars JOIN images ON images.avatar_id = avatars.id WHERE avatars.user_id = users.id) images ON true"},
+		// Qualified columns are selected from the subquery.
+		{"SELECT team_name, avatars.image_url FROM teams", "SELECT teams.team_name, avatars.image_url FROM teams LEFT JOIN LATERAL (SELECT array_agg(avatars.image_url) AS image_url FROM users JOIN avatars ON avatars.user_id = users.id WHERE users.team_id = teams.id) avatars ON true"},
+		// Wildcards can't be aggregated.
+		{"SELECT email, avatars.* FROM users", "SELECT users.email, avatars.* FROM users LEFT JOIN avatars ON avatars.user_id = users.id"},
+		// Functions that aren't aggregates can use the arrays.
+		{"SELECT email, cardinality(image_url) FROM users", "SELECT users.email, cardinality(avatars.image_url) FROM users LEFT JOIN LATERAL (SELECT array_agg(avatars.image_url) AS image_url FROM avatars WHERE avatars.user_id = users.id) avatars ON true"},
+		// Only the SELECT list is aggregated, other clauses can use other columns.
+		{"SELECT image_url FROM users WHERE email <> '' ORDER BY email", "SELECT avatars.image_url FROM users LEFT JOIN LATERAL (SELECT array_agg(avatars.image_url) AS image_url FROM avatars WHERE avatars.user_id = users.id) avatars ON true WHERE users.email <> '' ORDER BY users.email"},
+	} {
+		assertJoined(t, databaseInfo, searchPath, joinOptions{JoinBehavior: JoinBehaviorAggregate}, test.query, test.expected)
+	}
+
+	// Aggregated columns are arrays, so they can't be compared to their values
+	// or aggregated again.
+	for _, query := range []string{
+		"SELECT email FROM users WHERE image_url = 'me.png'",
+		"SELECT email, image_url FROM users GROUP BY email, image_url",
+		"SELECT email FROM users ORDER BY avatars.image_url",
+		"SELECT email, count(image_url) FROM users GROUP BY email",
+		"SELECT email, row_number() OVER (ORDER BY image_url) FROM users",
+	} {
+		assertJoinError(t, databaseInfo, searchPath, joinOptions{JoinBehavior: JoinBehaviorAggregate}, query, "image_url outside of the SELECT list or in an aggregate")
+	}
+}
+
+func TestAggregateAliases(t *testing.T) {
+	databaseInfo, searchPath := loadDDL(t, `
+		CREATE SCHEMA audit;
+		CREATE TABLE users (id INT PRIMARY KEY, email TEXT);
+		CREATE TABLE notes (id INT PRIMARY KEY, body TEXT, user_id INT NOT NULL REFERENCES users(id));
+		CREATE TABLE audit.notes (id INT PRIMARY KEY, action TEXT, user_id INT NOT NULL REFERENCES users(id));
+	`)
+
+	for _, test := range []struct {
+		query    string
+		expected string
+	}{
+		// Subqueries for tables with the same name are aliased by schema.
+		{"SELECT email, body, action FROM users", "SELECT users.email, public_notes.body, notes.action FROM users LEFT JOIN LATERAL (SELECT array_agg(notes.action) AS action FROM audit.notes WHERE notes.user_id = users.id) notes ON true LEFT JOIN LATERAL (SELECT array_agg(notes.body) AS body FROM notes WHERE notes.user_id = users.id) public_notes ON true"},
+		// So are subqueries, and tables in them, that share a name with a table in the query.
+		{"SELECT email, body FROM users notes", "SELECT notes.email, public_notes.body FROM users notes LEFT JOIN LATERAL (SELECT array_agg(public_notes.body) AS body FROM notes public_notes WHERE public_notes.user_id = notes.id) public_notes ON true"},
+	} {
+		assertJoined(t, databaseInfo, searchPath, joinOptions{JoinBehavior: JoinBehaviorAggregate}, test.query, test.expected)
+	}
+}
+
+// Makes joining to or from a table expensive.
+type avoidTablePathCost struct {
+	tableName string
+}
+
+func (c avoidTablePathCost) JoinCost(databaseInfo dbinfo.DatabaseInfo, tableName string, otherTableName string) int {
+	if tableName == c.tableName || otherTableName == c.tableName {
+		return 100
+	}
+	return 1
+}
+
+func TestPathCost(t *testing.T) {
+	databaseInfo, searchPath := loadDDL(t, `
+		CREATE TABLE projects (id INT PRIMARY KEY, name TEXT);
+		CREATE TABLE milestones (id INT PRIMARY KEY, project_id INT NOT NULL REFERENCES projects(id));
+		CREATE TABLE sprints (id INT PRIMARY KEY, project_id INT NOT NULL REFERENCES projects(id));
+		CREATE TABLE tasks (id INT PRIMARY KEY, body TEXT, milestone_id INT REFERENCES milestones(id), sprint_id INT NOT NULL REFERENCES sprints(id));
+	`)
+
+	for _, test := range []struct {
+		pathCost PathCost
+		expected string
+	}{
+		// Nullable foreign keys cost more by default.
+		{DefaultPathCost{}, "SELECT tasks.body, projects.name FROM tasks JOIN sprints ON tasks.sprint_id = sprints.id JOIN projects ON sprints.project_id = projects.id"},
+		{avoidTablePathCost{"public.sprints"}, "SELECT tasks.body, projects.name FROM tasks JOIN milestones ON tasks.milestone_id = milestones.id JOIN projects ON milestones.project_id = projects.id"},
+	} {
+		assertJoined(t, databaseInfo, searchPath, joinOptions{PathCost: test.pathCost}, "SELECT body, name FROM tasks", test.expected)
+	}
+}
+
+func TestRecursiveTermCantMultiplyRows(t *testing.T) {
+	databaseInfo, searchPath := loadDDL(t, `
+		CREATE TABLE categories (id INT PRIMARY KEY, parent_id INT REFERENCES categories(id), name TEXT);
+		CREATE TABLE products (id INT PRIMARY KEY, category_id INT REFERENCES categories(id), title TEXT);
+	`)
+
+	query := "WITH RECURSIVE tree AS (SELECT id, name FROM categories UNION ALL SELECT c.id, title FROM categories c JOIN tree ON c.parent_id = tree.id) SELECT name FROM tree"
+	assertJoinError(t, databaseInfo, searchPath, joinOptions{}, query, "recursive term of tree")
+
+	// Aggregating doesn't multiply rows.
+	_, _, err := joinQuery(t, databaseInfo, searchPath, joinOptions{JoinBehavior: JoinBehaviorAggregate}, query)
+	require.NoError(t, err)
+}
+
+func TestQualifyColumns(t *testing.T) {
+	databaseInfo, searchPath := loadDDL(t, `
+		CREATE TABLE users (id INT PRIMARY KEY, email TEXT, created_at TIMESTAMP);
+		CREATE TABLE contacts (id INT PRIMARY KEY, email TEXT, phone TEXT, user_id INT NOT NULL REFERENCES users(id));
+	`)
+
+	for _, test := range []struct {
+		query    string
+		expected string
+	}{
+		// Joined tables can make unqualified columns ambiguous.
+		{"SELECT email, phone FROM users", "SELECT users.email, contacts.phone FROM users JOIN contacts ON contacts.user_id = users.id"},
+		// Every clause is qualified, except for ORDER BY names of returned columns.
+		{"SELECT lower(email) AS email, count(phone) FROM users WHERE created_at > now() GROUP BY email HAVING min(phone) <> '' ORDER BY email", "SELECT lower(users.email) AS email, count(contacts.phone) FROM users JOIN contacts ON contacts.user_id = users.id WHERE users.created_at > now() GROUP BY users.email HAVING min(contacts.phone) <> '' ORDER BY email"},
+		// Names of returned columns that aren't table columns don't need a table.
+		{"SELECT email, count(phone) AS total FROM users GROUP BY email ORDER BY total", "SELECT users.email, count(contacts.phone) AS total FROM users JOIN contacts ON contacts.user_id = users.id GROUP BY users.email ORDER BY total"},
+		{"SELECT date_trunc('day', created_at) AS day, count(phone) FROM users GROUP BY day", "SELECT date_trunc('day', users.created_at) AS day, count(contacts.phone) FROM users JOIN contacts ON contacts.user_id = users.id GROUP BY day"},
+		// Queries without new joins are left as they are.
+		{"SELECT email FROM users", "SELECT email FROM users"},
+		{"SELECT count(*) AS total FROM users ORDER BY total", "SELECT count(*) AS total FROM users ORDER BY total"},
+		{"SELECT date_trunc('day', created_at) AS day, count(*) FROM users GROUP BY day", "SELECT date_trunc('day', created_at) AS day, count(*) FROM users GROUP BY day"},
+	} {
+		assertJoined(t, databaseInfo, searchPath, joinOptions{}, test.query, test.expected)
+	}
+}
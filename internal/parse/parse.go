@@ -2,7 +2,7 @@ package parse
 
 import (
 	"log/slog"
-	"reflect"
+	"strings"
 
 	pg_query "github.com/pganalyze/pg_query_go/v5"
 )
@@ -29,8 +29,17 @@ func (qc QueryColumn) String() string {
 }
 
 type QueryTable struct {
-	Name  string
-	Alias *string
+	// Empty if the table was not schema-qualified in the query.
+	Schema string
+	Name   string
+	Alias  *string
+}
+
+func (qt QueryTable) String() string {
+	if qt.Schema != "" {
+		return qt.Schema + "." + qt.Name
+	}
+	return qt.Name
 }
 
 type Query struct {
@@ -52,87 +61,90 @@ func getColumnsFromRef(ref *pg_query.ColumnRef) []QueryColumn {
 	if isWildcard && len(svals) == 0 {
 		return []QueryColumn{}
 	}
-	if len(svals) == 1 {
-		if len(ref.Fields) == 2 && isWildcard {
-			return []QueryColumn{{QueryColumnTypeTableWildcard, "*", &svals[0]}}
-		} else if len(ref.Fields) == 1 {
-			return []QueryColumn{{QueryColumnTypeColumn, svals[0], nil}}
-		}
-	} else if len(svals) == 2 {
-		return []QueryColumn{{QueryColumnTypeAliasedColumn, svals[1], &svals[0]}}
+	if isWildcard && len(ref.Fields) == len(svals)+1 {
+		// Table wildcards may be schema-qualified, ex: billing.invoices.*
+		alias := strings.Join(svals, ".")
+		return []QueryColumn{{QueryColumnTypeTableWildcard, "*", &alias}}
+	} else if len(svals) == 1 && len(ref.Fields) == 1 {
+		return []QueryColumn{{QueryColumnTypeColumn, svals[0], nil}}
+	} else if len(svals) >= 2 && len(ref.Fields) == len(svals) {
+		// Columns may be schema-qualified, ex: billing.invoices.amount, or
+		// qualified by a chain of foreign keys, ex: manager_id.manager_id.name
+		alias := strings.Join(svals[:len(svals)-1], ".")
+		return []QueryColumn{{QueryColumnTypeAliasedColumn, svals[len(svals)-1], &alias}}
 	} else {
 		slog.Debug("Could not determine type of column ref", slog.Any("columnRef", ref))
 	}
 	return []QueryColumn{}
 }
 
-func mergeQuery(a, b Query) Query {
-	for name, col := range b.Columns {
-		a.Columns[name] = col
+// Mimics how Postgres names output columns that aren't given a name. Table
+// wildcards (ex: t.*) are named "*".
+func TargetName(resTarget *pg_query.ResTarget) string {
+	if resTarget.Name != "" {
+		return resTarget.Name
 	}
-	for name, table := range b.Tables {
-		a.Tables[name] = table
+	val := resTarget.Val
+	for val.GetTypeCast() != nil {
+		val = val.GetTypeCast().Arg
 	}
-	return a
-}
-
-// Taken from https://github.com/pganalyze/pg_query_go/issues/18#issuecomment-475632691
-// Traverses the given query AST and pulls all table/column references out of it.
-func TraverseQuery(value interface{}, depth int) Query {
-	query := Query{
-		Columns: map[string]QueryColumn{},
-		Tables:  map[string]QueryTable{},
-	}
-
-	if value == nil {
-		return Query{
-			Columns: map[string]QueryColumn{},
-			Tables:  map[string]QueryTable{},
+	if columnRef := val.GetColumnRef(); columnRef != nil {
+		if columnRef.Fields[len(columnRef.Fields)-1].GetAStar() != nil {
+			return "*"
+		}
+		fields := stringValues(columnRef.Fields)
+		if len(fields) > 0 {
+			return fields[len(fields)-1]
+		}
+	} else if funcCall := val.GetFuncCall(); funcCall != nil {
+		funcname := stringValues(funcCall.Funcname)
+		if len(funcname) > 0 {
+			return funcname[len(funcname)-1]
 		}
 	}
+	return "?column?"
+}
 
-	t := reflect.TypeOf(value)
-	v := reflect.ValueOf(value)
+// Built-in aggregate functions, which can't be told apart from other functions
+// by how they're called.
+var aggregateFunctions = map[string]bool{
+	"any_value": true, "array_agg": true, "avg": true, "bit_and": true,
+	"bit_or": true, "bit_xor": true, "bool_and": true, "bool_or": true,
+	"corr": true, "count": true, "covar_pop": true, "covar_samp": true,
+	"every": true, "json_agg": true, "json_object_agg": true, "jsonb_agg": true,
+	"jsonb_object_agg": true, "max": true, "min": true, "mode": true,
+	"percentile_cont": true, "percentile_disc": true, "range_agg": true,
+	"range_intersect_agg": true, "regr_avgx": true, "regr_avgy": true,
+	"regr_count": true, "regr_intercept": true, "regr_r2": true,
+	"regr_slope": true, "regr_sxx": true, "regr_sxy": true, "regr_syy": true,
+	"stddev": true, "stddev_pop": true, "stddev_samp": true, "string_agg": true,
+	"sum": true, "var_pop": true, "var_samp": true, "variance": true,
+	"xmlagg": true,
+}
 
-	if v.Type() == reflect.TypeOf(pg_query.RangeVar{}) {
-		var alias *string
-		if value.(pg_query.RangeVar).Alias != nil {
-			alias = &value.(pg_query.RangeVar).Alias.Aliasname
-		}
-		query.Tables[value.(pg_query.RangeVar).Relname] = QueryTable{value.(pg_query.RangeVar).Relname, alias}
+// Returns true if a function call is a window function, or an aggregate that's
+// built in or called with aggregate syntax (ex: count(*) or count(DISTINCT id)).
+// User-defined aggregates called like other functions aren't detected.
+func IsAggregateCall(funcCall *pg_query.FuncCall) bool {
+	if funcCall.Over != nil || funcCall.AggStar || funcCall.AggDistinct || funcCall.AggWithinGroup || funcCall.AggFilter != nil || len(funcCall.AggOrder) > 0 {
+		return true
 	}
-
-	if v.Type() == reflect.TypeOf(pg_query.ColumnRef{}) {
-		columnRef := pg_query.ColumnRef{
-			Fields: value.(pg_query.ColumnRef).Fields,
-		}
-		for _, col := range getColumnsFromRef(&columnRef) {
-			query.Columns[col.String()] = col
-		}
+	funcname := stringValues(funcCall.Funcname)
+	if len(funcname) == 0 || (len(funcname) > 1 && funcname[0] != "pg_catalog") {
+		return false
 	}
+	return aggregateFunctions[funcname[len(funcname)-1]]
+}
 
-	switch t.Kind() {
-	case reflect.Ptr:
-		if v.Elem().IsValid() {
-			query = mergeQuery(query, TraverseQuery(v.Elem().Interface(), depth+1))
-		}
-	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice:
-		depth--
-		if v.Len() > 0 {
-			for i := 0; i < v.Len(); i++ {
-				depth++
-				query = mergeQuery(query, TraverseQuery(v.Index(i).Interface(), depth+1))
-				depth--
-			}
-		}
-	case reflect.Struct:
-		for i := 0; i < t.NumField(); i++ {
-			f := t.Field(i)
-			if !f.IsExported() {
-				continue
-			}
-			query = mergeQuery(query, TraverseQuery(reflect.ValueOf(value).Field(i).Interface(), depth+1))
+// Returns the qualifier of a column reference (ex: "billing.invoices" for
+// billing.invoices.amount), or an empty string if it is unqualified.
+func ColumnRefQualifier(ref *pg_query.ColumnRef) string {
+	svals := []string{}
+	for _, field := range ref.Fields[:len(ref.Fields)-1] {
+		if field.GetString_() == nil {
+			return ""
 		}
+		svals = append(svals, field.GetString_().Sval)
 	}
-	return query
+	return strings.Join(svals, ".")
 }
@@ -0,0 +1,353 @@
+package parse
+
+import (
+	"reflect"
+	"slices"
+
+	pg_query "github.com/pganalyze/pg_query_go/v5"
+)
+
+type ScopeType string
+
+var (
+	// The statement being joined.
+	ScopeTypeSelect ScopeType = "ScopeTypeSelect"
+	// The body of a WITH query.
+	ScopeTypeCTE ScopeType = "ScopeTypeCTE"
+	// A subquery in FROM.
+	ScopeTypeSubquery ScopeType = "ScopeTypeSubquery"
+	// A LATERAL subquery in FROM, which can reference the FROM items before it.
+	ScopeTypeLateral ScopeType = "ScopeTypeLateral"
+	// A subquery in an expression (ex: WHERE id IN (SELECT ...)).
+	ScopeTypeSubLink ScopeType = "ScopeTypeSubLink"
+	// One of the SELECTs of a set operation (ex: UNION).
+	ScopeTypeSetOperand ScopeType = "ScopeTypeSetOperand"
+	// The non-recursive term of a recursive CTE.
+	ScopeTypeNonRecursiveTerm ScopeType = "ScopeTypeNonRecursiveTerm"
+	// The recursive term of a recursive CTE, which references the CTE itself
+	// and is evaluated once per iteration.
+	ScopeTypeRecursiveTerm ScopeType = "ScopeTypeRecursiveTerm"
+)
+
+// A SELECT and the tables and columns it references itself. Nested SELECTs
+// (CTEs and subqueries) get their own scope, so joins can be added to the
+// SELECT that needs them.
+type Scope struct {
+	Query
+	Type ScopeType
+	// The name of a CTE, or the alias of a subquery in FROM.
+	Name string
+	Stmt *pg_query.SelectStmt
+	// Column references in this scope, which can be rewritten in place.
+	ColumnRefs []*pg_query.ColumnRef
+	// The column references in ColumnRefs that are in the target list.
+	TargetColumnRefs map[*pg_query.ColumnRef]bool
+	// The column references in ColumnRefs that are arguments to an aggregate
+	// or window function (ex: count(id)).
+	AggregateColumnRefs map[*pg_query.ColumnRef]bool
+	// CTEs and subqueries in FROM, by how they're referenced. CTE references
+	// are relations here rather than tables.
+	Relations map[string]*Scope
+	// CTEs defined by this scope's WITH clause, by name.
+	CTEs     map[string]*Scope
+	Parent   *Scope
+	Children []*Scope
+	// Names given to the returned columns, ex: WITH a(x, y) AS ...
+	columnAliases []string
+	// True for recursive CTEs that have a recursive term, which references
+	// the CTE itself.
+	recursive bool
+}
+
+// Builds the scope tree of a SELECT statement.
+func BuildScopeTree(stmt *pg_query.SelectStmt) *Scope {
+	scope := newScope(ScopeTypeSelect, "", stmt, nil)
+	scope.build()
+	return scope
+}
+
+func newScope(scopeType ScopeType, name string, stmt *pg_query.SelectStmt, parent *Scope) *Scope {
+	scope := &Scope{
+		Query: Query{
+			Columns: map[string]QueryColumn{},
+			Tables:  map[string]QueryTable{},
+		},
+		Type:                scopeType,
+		Name:                name,
+		Stmt:                stmt,
+		ColumnRefs:          []*pg_query.ColumnRef{},
+		TargetColumnRefs:    map[*pg_query.ColumnRef]bool{},
+		AggregateColumnRefs: map[*pg_query.ColumnRef]bool{},
+		Relations:           map[string]*Scope{},
+		CTEs:                map[string]*Scope{},
+		Parent:              parent,
+		Children:            []*Scope{},
+	}
+	if parent != nil {
+		parent.Children = append(parent.Children, scope)
+	}
+	return scope
+}
+
+// Calls visit for every column reference in this scope, but not in scopes
+// nested in it.
+func (s *Scope) VisitColumnRefs(visit func(ref *pg_query.ColumnRef)) {
+	for _, ref := range s.ColumnRefs {
+		visit(ref)
+	}
+}
+
+// Returns this scope and every scope nested in it, parents first.
+func (s *Scope) Scopes() []*Scope {
+	scopes := []*Scope{s}
+	for _, child := range s.Children {
+		scopes = append(scopes, child.Scopes()...)
+	}
+	return scopes
+}
+
+// Finds the CTE a relation name refers to in this scope or a parent.
+func (s *Scope) CTE(name string) (*Scope, bool) {
+	for scope := s; scope != nil; scope = scope.Parent {
+		if cte, ok := scope.CTEs[name]; ok {
+			return cte, true
+		}
+	}
+	return nil, false
+}
+
+// Returns the scopes this scope can reference tables from, other than itself.
+// Expression subqueries and LATERAL subqueries can reference their parent's
+// tables (ex: correlated subqueries), and so on for their parents. The SELECTs
+// of set operations can reference whatever the set operation can.
+func (s *Scope) OuterScopes() []*Scope {
+	scopes := []*Scope{}
+	for scope := s; scope.Parent != nil && scope.canReferenceParent(); scope = scope.Parent {
+		scopes = append(scopes, scope.Parent)
+	}
+	return scopes
+}
+
+func (s *Scope) canReferenceParent() bool {
+	switch s.Type {
+	case ScopeTypeSubLink, ScopeTypeLateral, ScopeTypeSetOperand, ScopeTypeNonRecursiveTerm, ScopeTypeRecursiveTerm:
+		return true
+	}
+	return false
+}
+
+// Returns the names of the columns this scope's SELECT returns, which is "*"
+// if they can't be determined.
+func (s *Scope) OutputColumns() []string {
+	stmt := s.Stmt
+	// Set operations return the columns of their first SELECT.
+	for stmt.Larg != nil {
+		stmt = stmt.Larg
+	}
+	columns := []string{}
+	for _, target := range stmt.TargetList {
+		resTarget := target.GetResTarget()
+		if resTarget == nil {
+			continue
+		}
+		columns = append(columns, TargetName(resTarget))
+	}
+	for i, alias := range s.columnAliases {
+		if i < len(columns) {
+			columns[i] = alias
+		}
+	}
+	return columns
+}
+
+// Returns true if a relation in this scope could return the given column.
+func (s *Scope) RelationHasColumn(name string) bool {
+	for _, relation := range s.Relations {
+		if columns := relation.OutputColumns(); slices.Contains(columns, name) || slices.Contains(columns, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scope) build() {
+	// CTEs are named before their bodies are built so that they can
+	// reference each other, or themselves if they're recursive.
+	if withClause := s.Stmt.WithClause; withClause != nil {
+		ctes := []*pg_query.CommonTableExpr{}
+		for _, node := range withClause.Ctes {
+			cte := node.GetCommonTableExpr()
+			if cte == nil || cte.Ctequery.GetSelectStmt() == nil {
+				continue
+			}
+			ctes = append(ctes, cte)
+			s.CTEs[cte.Ctename] = newScope(ScopeTypeCTE, cte.Ctename, cte.Ctequery.GetSelectStmt(), s)
+		}
+		for _, cte := range ctes {
+			cteScope := s.CTEs[cte.Ctename]
+			cteScope.columnAliases = stringValues(cte.Aliascolnames)
+			// Only UNIONs whose second SELECT references the CTE have a
+			// recursive term, the rest are regular set operations.
+			cteScope.recursive = withClause.Recursive && cteScope.Stmt.Op == pg_query.SetOperation_SETOP_UNION && referencesTable(reflect.ValueOf(cteScope.Stmt.Rarg), cte.Ctename)
+			cteScope.build()
+		}
+	}
+
+	// Each SELECT of a set operation (ex: UNION) is scoped separately, and so
+	// are the non-recursive and recursive terms of recursive CTEs.
+	if s.Stmt.Op != pg_query.SetOperation_SETOP_NONE {
+		largType, rargType := ScopeTypeSetOperand, ScopeTypeSetOperand
+		if s.recursive {
+			largType, rargType = ScopeTypeNonRecursiveTerm, ScopeTypeRecursiveTerm
+		}
+		newScope(largType, s.Name, s.Stmt.Larg, s).build()
+		newScope(rargType, s.Name, s.Stmt.Rarg, s).build()
+	}
+
+	// Walk the rest of the SELECT.
+	v := reflect.ValueOf(s.Stmt).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() || field.Name == "WithClause" || field.Name == "Larg" || field.Name == "Rarg" {
+			continue
+		}
+		start := len(s.ColumnRefs)
+		s.walk(v.Field(i))
+		if field.Name == "TargetList" {
+			for _, ref := range s.ColumnRefs[start:] {
+				s.TargetColumnRefs[ref] = true
+			}
+		}
+	}
+}
+
+func (s *Scope) walk(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		switch node := v.Interface().(type) {
+		case *pg_query.ColumnRef:
+			s.ColumnRefs = append(s.ColumnRefs, node)
+			for _, col := range getColumnsFromRef(node) {
+				s.Columns[col.String()] = col
+			}
+			return
+		case *pg_query.RangeVar:
+			s.addRangeVar(node)
+			return
+		case *pg_query.FuncCall:
+			if !IsAggregateCall(node) {
+				break
+			}
+			start := len(s.ColumnRefs)
+			s.walk(v.Elem())
+			for _, ref := range s.ColumnRefs[start:] {
+				s.AggregateColumnRefs[ref] = true
+			}
+			return
+		case *pg_query.RangeSubselect:
+			subquery := node.Subquery.GetSelectStmt()
+			if subquery == nil {
+				break
+			}
+			scopeType := ScopeTypeSubquery
+			if node.Lateral {
+				scopeType = ScopeTypeLateral
+			}
+			name := ""
+			if node.Alias != nil {
+				name = node.Alias.Aliasname
+			}
+			scope := newScope(scopeType, name, subquery, s)
+			if node.Alias != nil {
+				s.Relations[name] = scope
+				scope.columnAliases = stringValues(node.Alias.Colnames)
+			}
+			scope.build()
+			return
+		case *pg_query.SubLink:
+			subquery := node.Subselect.GetSelectStmt()
+			if subquery == nil {
+				break
+			}
+			s.walk(reflect.ValueOf(node.Testexpr))
+			newScope(ScopeTypeSubLink, "", subquery, s).build()
+			return
+		}
+		s.walk(v.Elem())
+	case reflect.Interface:
+		if !v.IsNil() {
+			s.walk(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			s.walk(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			s.walk(v.Field(i))
+		}
+	}
+}
+
+// Tables are added to the scope, unless they refer to a CTE.
+func (s *Scope) addRangeVar(rangeVar *pg_query.RangeVar) {
+	var alias *string
+	if rangeVar.Alias != nil {
+		alias = &rangeVar.Alias.Aliasname
+	}
+	if cte, ok := s.CTE(rangeVar.Relname); ok && rangeVar.Schemaname == "" {
+		name := rangeVar.Relname
+		if alias != nil {
+			name = *alias
+		}
+		s.Relations[name] = cte
+		return
+	}
+	table := QueryTable{rangeVar.Schemaname, rangeVar.Relname, alias}
+	s.Tables[table.String()] = table
+}
+
+// Returns true if an unqualified table name is used anywhere in a node.
+func referencesTable(v reflect.Value, name string) bool {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return false
+		}
+		if rangeVar, ok := v.Interface().(*pg_query.RangeVar); ok {
+			return rangeVar.Schemaname == "" && rangeVar.Relname == name
+		}
+		return referencesTable(v.Elem(), name)
+	case reflect.Interface:
+		return !v.IsNil() && referencesTable(v.Elem(), name)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if referencesTable(v.Index(i), name) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() && referencesTable(v.Field(i), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stringValues(nodes []*pg_query.Node) []string {
+	values := []string{}
+	for _, node := range nodes {
+		if node.GetString_() != nil {
+			values = append(values, node.GetString_().Sval)
+		}
+	}
+	return values
+}
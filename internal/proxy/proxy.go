@@ -28,14 +28,20 @@ type ProxyServer struct {
 }
 
 type ProxyServerConfig struct {
-	DatabaseName                 string
-	DatabaseUrl                  string
+	// Only queries to this database are joined.
+	DatabaseName string
+	DatabaseUrl  string
+	// Where schema is read from instead of DatabaseUrl, if anywhere, and
+	// relationships to join on that aren't real foreign keys.
+	SchemaSource                 dbinfo.SchemaSource
 	OnlyRespondToAutoJoins       bool
 	ShouldPrefixFieldDescriptors bool
 	ProxyAddress                 string
 	MaxCacheTTL                  time.Duration
 	JoinBehavior                 join.JoinBehavior
-	TLSConfig                    *tls.Config
+	// Scores paths between tables, defaults to join.DefaultPathCost.
+	PathCost  join.PathCost
+	TLSConfig *tls.Config
 }
 
 func (s *ProxyServer) Serve(ln net.Listener) error {
@@ -86,7 +92,7 @@ func handleQueryStringMessage(cfg ProxyServerConfig, ctx *proxy.Ctx, queryString
 		return queryString
 	}
 
-	databaseInfo, err := getDatabaseInfo(ctx.Context, cfg.DatabaseUrl, cfg.MaxCacheTTL)
+	databaseInfo, err := getDatabaseInfo(ctx.Context, cfg)
 	if err != nil {
 		slog.Error("Could not get db info for query", slog.Any("error", err))
 		if keywordAutoJoin {
@@ -96,7 +102,8 @@ func handleQueryStringMessage(cfg ProxyServerConfig, ctx *proxy.Ctx, queryString
 		}
 	}
 
-	joinPlan, err := join.AddMissingJoinsToQuery(parsedQuery, *databaseInfo, cfg.JoinBehavior)
+	searchPath := startupSearchPath(ctx.ConnInfo.StartupParameters)
+	joinPlan, err := join.AddMissingJoinsToQuery(parsedQuery, *databaseInfo, cfg.JoinBehavior, cfg.PathCost, dbinfo.ParseSearchPath(searchPath, ctx.ConnInfo.StartupParameters["user"]))
 	if err != nil {
 		slog.Debug("Could not add missing joins to query", slog.Any("error", err))
 		if keywordAutoJoin {
@@ -121,16 +128,20 @@ func handleQueryStringMessage(cfg ProxyServerConfig, ctx *proxy.Ctx, queryString
 	if keywordAutoJoin {
 		if keywordAutoJoinVerbose && len(joinPlan.MissingColumnsToPossibleTables) > 0 {
 			possibleRows := []string{
-				"(" + pq.QuoteLiteral(deparse) + ", '', '')",
+				"(" + pq.QuoteLiteral(deparse) + ", '', '', '')",
 			}
 			for missingColumn, possibleTableNames := range joinPlan.MissingColumnsToPossibleTables {
 				possibleRows = append(possibleRows, fmt.Sprintf(
-					"('', %s, %s)",
+					"('', %s, %s, '')",
 					pq.QuoteLiteral(missingColumn),
 					pq.QuoteLiteral(strings.Join(slices.Sorted(maps.Keys(possibleTableNames)), ","))),
 				)
 			}
-			return fmt.Sprintf("SELECT * FROM (VALUES %s) as t (new_query, missing_column, possible_tables)", strings.Join(possibleRows, ","))
+			// Joins say which foreign key they used, and if it was declared.
+			for _, addedJoin := range joinPlan.Joins {
+				possibleRows = append(possibleRows, fmt.Sprintf("('', '', '', %s)", pq.QuoteLiteral(addedJoin.String())))
+			}
+			return fmt.Sprintf("SELECT * FROM (VALUES %s) as t (new_query, missing_column, possible_tables, join_used)", strings.Join(possibleRows, ","))
 		} else {
 			return fmt.Sprintf("SELECT %s AS new_query", pq.QuoteLiteral(deparse))
 		}
@@ -141,6 +152,64 @@ func handleQueryStringMessage(cfg ProxyServerConfig, ctx *proxy.Ctx, queryString
 	}
 }
 
+// Returns the search_path a client connected with, which can be a startup
+// parameter or set in the options startup parameter (ex: -c search_path=foo).
+// Like Postgres, the startup parameter takes precedence. Changes made later
+// with SET aren't tracked.
+func startupSearchPath(startupParameters map[string]string) string {
+	if searchPath, ok := startupParameters["search_path"]; ok {
+		return searchPath
+	}
+	searchPath := dbinfo.DefaultSearchPath
+	options := splitStartupOptions(startupParameters["options"])
+	for i := 0; i < len(options); i++ {
+		setting := ""
+		if options[i] == "-c" && i+1 < len(options) {
+			i++
+			setting = options[i]
+		} else if strings.HasPrefix(options[i], "--") {
+			setting = strings.TrimPrefix(options[i], "--")
+		} else if strings.HasPrefix(options[i], "-c") {
+			setting = strings.TrimPrefix(options[i], "-c")
+		}
+		name, value, ok := strings.Cut(setting, "=")
+		if ok && strings.ReplaceAll(name, "-", "_") == "search_path" {
+			searchPath = value
+		}
+	}
+	return searchPath
+}
+
+// Splits the options startup parameter on whitespace, where a backslash
+// escapes the character after it.
+func splitStartupOptions(options string) []string {
+	args := []string{}
+	var arg strings.Builder
+	inArg, escaped := false, false
+	for _, r := range options {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			inArg, escaped = true, true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args
+}
+
 func NewProxyServer(cfg ProxyServerConfig) *ProxyServer {
 	clientMessageHandlers := proxy.NewClientMessageHandlers()
 
@@ -167,10 +236,12 @@ func NewProxyServer(cfg ProxyServerConfig) *ProxyServer {
 		// It's fairly useful to prefix columns with the joined table, although
 		// what would be really nice is to coerce the joiner to go through specific
 		// routes to get what you want.
+		// Tables joined more than once (ex: for created_by.email and
+		// updated_by.email) are prefixed with their alias.
 		for i := range msg.Fields {
-			table, hasTable := joinPlan.MissingColumnsToJoinedTables[msg.Fields[i].Name]
-			if hasTable {
-				msg.Fields[i].Name = table + "_" + msg.Fields[i].Name
+			reference, ok := joinPlan.JoinedReturnedColumns[i]
+			if ok {
+				msg.Fields[i].Name = reference + "_" + msg.Fields[i].Name
 			}
 		}
 		return msg, nil
@@ -194,7 +265,8 @@ type DatabaseInfoCache struct {
 	CreatedAt    time.Time
 }
 
-// Map of database urls to DatabaseInfoCache.
+// Map of database urls (or schema files/migration directories/snapshots) to
+// DatabaseInfoCache.
 // While the proxy only works for a single database url now, hypothetically it
 // should be possible to hijack any client connection to any database to get
 // schema info. We don't do this right now because it's hard.
@@ -203,15 +275,19 @@ var databaseInfoCache = map[string]*DatabaseInfoCache{}
 // Possibly stupid way to lock individual keys in a map.
 var infoCacheLocks = sync.Map{}
 
-func getDatabaseInfo(ctx context.Context, dburl string, maxCacheTTL time.Duration) (*dbinfo.DatabaseInfo, error) {
-	storedLock, _ := infoCacheLocks.LoadOrStore(dburl, &sync.RWMutex{})
+func getDatabaseInfo(ctx context.Context, cfg ProxyServerConfig) (*dbinfo.DatabaseInfo, error) {
+	cacheKey := cfg.DatabaseUrl
+	if cfg.SchemaSource.Path() != "" {
+		cacheKey = cfg.SchemaSource.Path()
+	}
+	storedLock, _ := infoCacheLocks.LoadOrStore(cacheKey, &sync.RWMutex{})
 	lock := storedLock.(*sync.RWMutex)
 
 	// Read existing cache.
 	lock.RLock()
-	cacheInfo, hasCacheInfo := databaseInfoCache[dburl]
+	cacheInfo, hasCacheInfo := databaseInfoCache[cacheKey]
 	lock.RUnlock()
-	if hasCacheInfo && maxCacheTTL != 0 && time.Since(cacheInfo.CreatedAt) < maxCacheTTL {
+	if hasCacheInfo && cfg.MaxCacheTTL != 0 && time.Since(cacheInfo.CreatedAt) < cfg.MaxCacheTTL {
 		return cacheInfo.DatabaseInfo, nil
 	}
 
@@ -219,20 +295,23 @@ func getDatabaseInfo(ctx context.Context, dburl string, maxCacheTTL time.Duratio
 	lock.Lock()
 	defer lock.Unlock()
 
-	conn, err := pgx.Connect(ctx, dburl)
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close(ctx)
-
 	// Gather information on what columns, tables, and fkeys exists.
-	databaseInfo, err := dbinfo.GetDatabaseInfoResult(ctx, conn)
+	var conn *pgx.Conn
+	if cfg.SchemaSource.Path() == "" {
+		var err error
+		conn, err = pgx.Connect(ctx, cfg.DatabaseUrl)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close(ctx)
+	}
+	databaseInfo, err := cfg.SchemaSource.GetDatabaseInfo(ctx, conn)
 	if err != nil {
 		return nil, err
 	}
-	databaseInfoCache[dburl] = &DatabaseInfoCache{
+	databaseInfoCache[cacheKey] = &DatabaseInfoCache{
 		DatabaseInfo: &databaseInfo,
 		CreatedAt:    time.Now(),
 	}
-	return databaseInfoCache[dburl].DatabaseInfo, nil
+	return databaseInfoCache[cacheKey].DatabaseInfo, nil
 }
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/mortenson/pg-autojoin/internal/dbinfo"
 	"github.com/stretchr/testify/require"
 )
 
@@ -73,3 +74,21 @@ func TestProxy(t *testing.T) {
 	`)
 	require.NoError(t, err)
 }
+
+func TestStartupSearchPath(t *testing.T) {
+	for _, test := range []struct {
+		startupParameters map[string]string
+		expected          string
+	}{
+		{map[string]string{}, dbinfo.DefaultSearchPath},
+		{map[string]string{"search_path": "billing"}, "billing"},
+		{map[string]string{"options": "-c search_path=billing"}, "billing"},
+		{map[string]string{"options": "-csearch_path=billing,\\ public -c statement_timeout=5s"}, "billing, public"},
+		{map[string]string{"options": "--search-path=billing-2024"}, "billing-2024"},
+		{map[string]string{"options": "-c statement_timeout=5s"}, dbinfo.DefaultSearchPath},
+		// The startup parameter takes precedence over options.
+		{map[string]string{"search_path": "public", "options": "-c search_path=billing"}, "public"},
+	} {
+		require.Equal(t, test.expected, startupSearchPath(test.startupParameters))
+	}
+}
@@ -0,0 +1,5 @@
+SELECT orders.total, addresses.city FROM orders
+ JOIN addresses ON orders.shipping_address_id = addresses.id;
+
+ SELECT orders.total, customers.name FROM orders
+ JOIN customers ON orders.customer_ref = customers.external_id
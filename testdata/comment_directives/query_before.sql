@@ -0,0 +1,5 @@
+-- join orders -> addresses using the preferred foreign key
+SELECT total, city FROM orders;
+
+-- join orders -> customers using the column comment, instead of audit_log
+SELECT total, name FROM orders;
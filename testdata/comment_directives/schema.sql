@@ -0,0 +1,30 @@
+CREATE TABLE addresses (
+  id INT NOT NULL PRIMARY KEY,
+  city TEXT NOT NULL
+);
+
+CREATE TABLE customers (
+  id INT NOT NULL PRIMARY KEY,
+  external_id TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL
+);
+
+CREATE TABLE orders (
+  id INT NOT NULL PRIMARY KEY,
+  customer_ref TEXT NOT NULL,
+  billing_address_id INT NOT NULL REFERENCES addresses(id),
+  shipping_address_id INT NOT NULL REFERENCES addresses(id),
+  total NUMERIC NOT NULL
+);
+
+-- Would make name ambiguous if it wasn't ignored.
+CREATE TABLE audit_log (
+  id INT NOT NULL PRIMARY KEY,
+  order_id INT NOT NULL REFERENCES orders(id),
+  name TEXT NOT NULL
+);
+
+COMMENT ON TABLE audit_log IS '@autojoin ignore';
+COMMENT ON COLUMN orders.customer_ref IS 'The customer''s id in the billing system.
+@autojoin references customers(external_id)';
+COMMENT ON CONSTRAINT orders_shipping_address_id_fkey ON orders IS '@autojoin prefer';
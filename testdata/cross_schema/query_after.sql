@@ -0,0 +1,5 @@
+SELECT profiles.bio, users.email FROM profiles
+ JOIN auth.users ON profiles.id = users.id;
+
+ SELECT users.name, auth_users.email FROM users
+ JOIN auth.users auth_users ON users.auth_user_id = auth_users.id
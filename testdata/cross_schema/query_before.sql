@@ -0,0 +1,5 @@
+-- join profiles -> auth.users
+SELECT bio, email FROM profiles;
+
+-- join users -> auth.users, aliased since both are named "users"
+SELECT name, auth.users.email FROM users;
@@ -0,0 +1,19 @@
+-- Foreign keys can reference tables in other schemas, even ones that share a
+-- name with a table on the search path.
+CREATE SCHEMA auth;
+
+CREATE TABLE auth.users (
+  id INT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL
+);
+
+CREATE TABLE users (
+  id INT NOT NULL PRIMARY KEY,
+  name TEXT NOT NULL,
+  auth_user_id INT NOT NULL REFERENCES auth.users(id)
+);
+
+CREATE TABLE profiles (
+  id INT NOT NULL PRIMARY KEY REFERENCES auth.users(id),
+  bio TEXT NOT NULL
+);
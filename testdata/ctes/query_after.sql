@@ -0,0 +1,10 @@
+WITH owned AS (SELECT products.title, users.email FROM products
+ JOIN categories ON products.category_id = categories.id
+ JOIN users ON categories.owner_id = users.id), counts AS (SELECT email, count(*) AS total FROM owned GROUP BY email) SELECT email, total FROM counts;
+
+ WITH RECURSIVE tree(category_id, depth, owner_email) AS (SELECT categories.id, 0, users.email FROM categories
+ JOIN users ON categories.owner_id = users.id WHERE categories.parent_id IS NULL UNION ALL SELECT c.id, depth + 1, users.email FROM categories c JOIN tree ON c.parent_id = tree.category_id
+ JOIN users ON c.owner_id = users.id) SELECT tree.depth, owner_email, name FROM tree JOIN categories ON categories.id = tree.category_id;
+
+ WITH RECURSIVE names AS (SELECT name FROM categories UNION SELECT products.title FROM categories
+ JOIN products ON products.category_id = categories.id) SELECT * FROM names
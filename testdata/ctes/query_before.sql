@@ -0,0 +1,12 @@
+-- each CTE is joined on its own, and its columns can be used by the outer query
+WITH owned AS (SELECT title, email FROM products), counts AS (SELECT email, count(*) AS total FROM owned GROUP BY email) SELECT email, total FROM counts;
+
+-- the non-recursive and recursive terms are joined separately
+WITH RECURSIVE tree(category_id, depth, owner_email) AS (
+  SELECT id, 0, email FROM categories WHERE parent_id IS NULL
+  UNION ALL
+  SELECT c.id, depth + 1, users.email FROM categories c JOIN tree ON c.parent_id = tree.category_id
+) SELECT tree.depth, owner_email, name FROM tree JOIN categories ON categories.id = tree.category_id;
+
+-- UNIONs in WITH RECURSIVE that don't reference themselves aren't recursive
+WITH RECURSIVE names AS (SELECT name FROM categories UNION SELECT title FROM categories) SELECT * FROM names;
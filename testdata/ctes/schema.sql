@@ -0,0 +1,17 @@
+CREATE TABLE users (
+  id INT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL
+);
+
+CREATE TABLE categories (
+  id INT NOT NULL PRIMARY KEY,
+  parent_id INT REFERENCES categories(id),
+  owner_id INT NOT NULL REFERENCES users(id),
+  name TEXT NOT NULL
+);
+
+CREATE TABLE products (
+  id INT NOT NULL PRIMARY KEY,
+  category_id INT NOT NULL REFERENCES categories(id),
+  title TEXT NOT NULL
+);
@@ -0,0 +1,10 @@
+SELECT posts.title, avatars.image_url FROM posts, users
+ JOIN avatars ON avatars.user_id = users.id WHERE posts.author_id = users.id;
+
+ SELECT tags.label, avatars.image_url FROM tags, posts
+ JOIN users ON users.id = posts.author_id
+ JOIN avatars ON avatars.user_id = users.id;
+
+ SELECT t.label, u.email, avatars.image_url FROM tags t, posts p
+ LEFT JOIN users u ON u.id = p.author_id
+ JOIN avatars ON avatars.user_id = u.id
@@ -0,0 +1,6 @@
+-- joins are added to the FROM item with the table they're joined from
+SELECT title, image_url FROM posts, users WHERE posts.author_id = users.id;
+
+SELECT label, image_url FROM tags, posts JOIN users ON users.id = posts.author_id;
+
+SELECT label, u.email, image_url FROM tags t, posts p LEFT JOIN users u ON u.id = p.author_id;
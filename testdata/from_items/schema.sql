@@ -0,0 +1,21 @@
+CREATE TABLE users (
+  id INT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL
+);
+
+CREATE TABLE avatars (
+  id INT NOT NULL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id),
+  image_url TEXT NOT NULL
+);
+
+CREATE TABLE posts (
+  id INT NOT NULL PRIMARY KEY,
+  author_id INT NOT NULL REFERENCES users(id),
+  title TEXT NOT NULL
+);
+
+CREATE TABLE tags (
+  id INT NOT NULL PRIMARY KEY,
+  label TEXT NOT NULL
+);
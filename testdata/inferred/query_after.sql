@@ -0,0 +1,7 @@
+SELECT people.full_name, companies.company_name FROM people
+ JOIN companies ON people.company_id = companies.id;
+
+ SELECT posts.title, categories.category_name, companies.company_name FROM posts
+ JOIN categories ON posts.fk_category_id = categories.id
+ JOIN people ON posts.person_id = people.id
+ JOIN companies ON people.company_id = companies.id
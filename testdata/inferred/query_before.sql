@@ -0,0 +1,6 @@
+-- join people -> companies, inferred from people.company_id
+SELECT full_name, company_name FROM people;
+
+-- join posts -> categories and posts -> people -> companies, inferred from
+-- posts.fk_category_id and posts.person_id
+SELECT title, category_name, company_name FROM posts;
@@ -0,0 +1,25 @@
+-- None of these tables have foreign keys, see relationships.yaml.
+CREATE TABLE companies (
+  id INT NOT NULL PRIMARY KEY,
+  company_name TEXT NOT NULL
+);
+
+CREATE TABLE people (
+  id INT NOT NULL PRIMARY KEY,
+  full_name TEXT NOT NULL,
+  company_id INT NOT NULL
+);
+
+CREATE TABLE categories (
+  id INT NOT NULL PRIMARY KEY,
+  category_name TEXT NOT NULL
+);
+
+CREATE TABLE posts (
+  id INT NOT NULL PRIMARY KEY,
+  person_id INT NOT NULL,
+  fk_category_id INT NOT NULL,
+  -- There's no tags table, so this isn't inferred.
+  tag_id INT,
+  title TEXT NOT NULL
+);
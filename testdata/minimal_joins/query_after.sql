@@ -0,0 +1,7 @@
+SELECT tasks.body, projects.name, sprints.sprint_name FROM tasks
+ JOIN sprints ON tasks.sprint_id = sprints.id
+ JOIN projects ON sprints.project_id = projects.id;
+
+ SELECT tasks.body, sprints.sprint_name, projects.name FROM tasks
+ JOIN sprints ON tasks.sprint_id = sprints.id
+ JOIN projects ON sprints.project_id = projects.id
@@ -0,0 +1,6 @@
+-- name could be joined through milestones or sprints, but sprints is needed
+-- for sprint_name anyway
+SELECT body, name, sprint_name FROM tasks;
+
+-- the order columns are selected in doesn't change the joins
+SELECT body, sprint_name, name FROM tasks;
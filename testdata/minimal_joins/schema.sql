@@ -0,0 +1,23 @@
+CREATE TABLE projects (
+  id INT NOT NULL PRIMARY KEY,
+  name TEXT NOT NULL
+);
+
+CREATE TABLE milestones (
+  id INT NOT NULL PRIMARY KEY,
+  project_id INT NOT NULL REFERENCES projects(id),
+  due_date DATE
+);
+
+CREATE TABLE sprints (
+  id INT NOT NULL PRIMARY KEY,
+  project_id INT NOT NULL REFERENCES projects(id),
+  sprint_name TEXT NOT NULL
+);
+
+CREATE TABLE tasks (
+  id INT NOT NULL PRIMARY KEY,
+  milestone_id INT NOT NULL REFERENCES milestones(id),
+  sprint_id INT NOT NULL REFERENCES sprints(id),
+  body TEXT NOT NULL
+);
@@ -0,0 +1,8 @@
+SELECT messages.body, users.email FROM messages
+ JOIN users ON messages.recipient_id = users.id;
+
+ SELECT messages.body, users_sender.email FROM messages
+ JOIN users users_sender ON messages.sender_id = users_sender.id;
+
+ SELECT messages.body, users_sender.email FROM messages
+ JOIN users users_sender ON messages.sender_id = users_sender.id WHERE users_sender.email LIKE '%@example.com'
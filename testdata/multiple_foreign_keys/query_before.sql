@@ -0,0 +1,8 @@
+-- messages has two foreign keys to users, the first by constraint name is used
+SELECT body, email FROM messages;
+
+-- qualify the column by the foreign key's column to pick which is used
+SELECT body, sender_id.email FROM messages;
+
+-- or by its constraint name
+SELECT body, messages_sender_id_fkey.email FROM messages WHERE messages_sender_id_fkey.email LIKE '%@example.com';
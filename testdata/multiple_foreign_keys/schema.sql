@@ -0,0 +1,11 @@
+CREATE TABLE users (
+  id INT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL
+);
+
+CREATE TABLE messages (
+  id INT NOT NULL PRIMARY KEY,
+  sender_id INT NOT NULL REFERENCES users(id),
+  recipient_id INT NOT NULL REFERENCES users(id),
+  body TEXT NOT NULL
+);
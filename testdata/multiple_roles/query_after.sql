@@ -0,0 +1,19 @@
+SELECT documents.title, users_created_by.email, users_updated_by.email FROM documents
+ JOIN users users_created_by ON documents.created_by = users_created_by.id
+ JOIN users users_updated_by ON documents.updated_by = users_updated_by.id;
+
+ SELECT documents.title, users.email, users_updated_by.email, teams.team_name FROM documents
+ JOIN users users_updated_by ON documents.updated_by = users_updated_by.id
+ JOIN teams ON documents.team_id = teams.id
+ JOIN users ON documents.created_by = users.id;
+
+ SELECT documents.title, users_created_by.email, users_created_by.email FROM documents
+ JOIN users users_created_by ON documents.created_by = users_created_by.id;
+
+ SELECT documents.title, teams_team_owner.email, users_created_by.email FROM documents
+ JOIN users users_created_by ON documents.created_by = users_created_by.id
+ JOIN teams teams_team ON documents.team_id = teams_team.id
+ JOIN users teams_team_owner ON teams_team.owner_id = teams_team_owner.id;
+
+SELECT documents.title, teams_team.* FROM documents
+ JOIN teams teams_team ON documents.team_id = teams_team.id
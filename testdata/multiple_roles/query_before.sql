@@ -0,0 +1,14 @@
+-- join users once per foreign key
+SELECT title, created_by.email, updated_by.email FROM documents;
+
+-- unqualified columns use the default foreign key, reusing a role's join if
+-- it's the same one
+SELECT title, email, updated_by.email, team_name FROM documents;
+
+SELECT title, email, created_by.email FROM documents;
+
+-- roles can be chained through other tables
+SELECT title, team_id.owner_id.email, created_by.email FROM documents;
+
+-- wildcards can be qualified by roles too
+SELECT title, team_id.* FROM documents;
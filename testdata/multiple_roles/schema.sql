@@ -0,0 +1,18 @@
+CREATE TABLE users (
+  id INT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL
+);
+
+CREATE TABLE teams (
+  id INT NOT NULL PRIMARY KEY,
+  team_name TEXT NOT NULL,
+  owner_id INT NOT NULL REFERENCES users(id)
+);
+
+CREATE TABLE documents (
+  id INT NOT NULL PRIMARY KEY,
+  title TEXT NOT NULL,
+  team_id INT NOT NULL REFERENCES teams(id),
+  created_by INT NOT NULL REFERENCES users(id),
+  updated_by INT REFERENCES users(id)
+);
@@ -0,0 +1,8 @@
+SELECT users.email, events.payload FROM users
+ JOIN events ON events.user_id = users.id;
+
+ SELECT users.email, notes.body FROM users
+ JOIN notes ON notes.user_id = users.id;
+
+ SELECT pinned_notes.body, pinned_notes.pinned_at, users.email FROM pinned_notes
+ JOIN users ON pinned_notes.user_id = users.id
@@ -0,0 +1,8 @@
+-- join users -> events, not one of its partitions
+SELECT email, payload FROM users;
+
+-- join users -> notes, not pinned_notes
+SELECT email, body FROM users;
+
+-- join pinned_notes -> users, using the foreign key pinned_notes inherits
+SELECT body, pinned_at, email FROM pinned_notes;
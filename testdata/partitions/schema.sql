@@ -0,0 +1,26 @@
+CREATE TABLE users (
+  id INT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL
+);
+
+-- Partitions are collapsed into events, so payload isn't ambiguous.
+CREATE TABLE events (
+  id INT NOT NULL,
+  user_id INT NOT NULL REFERENCES users(id),
+  created_at TIMESTAMP NOT NULL,
+  payload TEXT
+) PARTITION BY RANGE (created_at);
+
+CREATE TABLE events_2026_01 PARTITION OF events FOR VALUES FROM ('2026-01-01') TO ('2026-02-01');
+CREATE TABLE events_2026_02 PARTITION OF events FOR VALUES FROM ('2026-02-01') TO ('2026-03-01');
+
+-- Inherited columns belong to notes, but pinned_notes can use its foreign keys.
+CREATE TABLE notes (
+  id INT NOT NULL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id),
+  body TEXT NOT NULL
+);
+
+CREATE TABLE pinned_notes (
+  pinned_at TIMESTAMP NOT NULL
+) INHERITS (notes);
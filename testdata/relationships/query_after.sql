@@ -0,0 +1,7 @@
+SELECT orders.total, customers.name FROM orders
+ JOIN customers ON orders.customer_ref = customers.external_id;
+
+ SELECT shipments.shipped_at, warehouses.city, customers.name FROM shipments
+ JOIN warehouses ON shipments.warehouse_region = warehouses.region AND shipments.warehouse_code = warehouses.code
+ JOIN orders ON shipments.order_id = orders.id
+ JOIN customers ON orders.customer_ref = customers.external_id
@@ -0,0 +1,6 @@
+-- join orders -> customers, using a declared relationship
+SELECT total, name FROM orders;
+
+-- join shipments -> warehouses using a composite declared relationship, and
+-- shipments -> orders -> customers
+SELECT shipped_at, city, name FROM shipments;
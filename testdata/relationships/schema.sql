@@ -0,0 +1,27 @@
+-- None of these tables have foreign keys, see relationships.yaml.
+CREATE TABLE customers (
+  id INT NOT NULL PRIMARY KEY,
+  external_id TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL
+);
+
+CREATE TABLE orders (
+  id INT NOT NULL PRIMARY KEY,
+  customer_ref TEXT NOT NULL,
+  total NUMERIC NOT NULL
+);
+
+CREATE TABLE warehouses (
+  region TEXT NOT NULL,
+  code TEXT NOT NULL,
+  city TEXT NOT NULL,
+  PRIMARY KEY (region, code)
+);
+
+CREATE TABLE shipments (
+  id INT NOT NULL PRIMARY KEY,
+  order_id INT NOT NULL,
+  warehouse_region TEXT NOT NULL,
+  warehouse_code TEXT NOT NULL,
+  shipped_at TIMESTAMP
+);
@@ -0,0 +1,8 @@
+SELECT line_items.description FROM billing.invoices
+ JOIN billing.line_items ON line_items.invoice_id = invoices.id;
+
+ SELECT invoices.amount FROM billing.line_items li
+ JOIN billing.invoices ON li.invoice_id = invoices.id;
+
+ SELECT billing.line_items.id, invoices.amount FROM billing.invoices
+ JOIN billing.line_items ON line_items.invoice_id = invoices.id
@@ -0,0 +1,8 @@
+-- join billing.invoices -> billing.line_items, qualified since billing is not on the search path
+SELECT description FROM billing.invoices;
+
+-- join billing.line_items -> billing.invoices, using the existing alias in conditions
+SELECT amount FROM billing.line_items li;
+
+-- join billing.invoices -> billing.line_items due to the schema-qualified column
+SELECT billing.line_items.id, amount FROM billing.invoices;
@@ -0,0 +1,13 @@
+-- Tables outside of the search path should still be joinable.
+CREATE SCHEMA billing;
+
+CREATE TABLE billing.invoices (
+  id INT NOT NULL PRIMARY KEY,
+  amount INT NOT NULL
+);
+
+CREATE TABLE billing.line_items (
+  id INT NOT NULL PRIMARY KEY,
+  invoice_id INT NOT NULL REFERENCES billing.invoices(id),
+  description TEXT NOT NULL
+);
@@ -0,0 +1,14 @@
+SELECT employees.name, employees_manager.name FROM employees
+ JOIN employees employees_manager ON employees.manager_id = employees_manager.id;
+
+ SELECT e.name, employees_manager_manager.name FROM employees e
+ JOIN employees employees_manager ON e.manager_id = employees_manager.id
+ JOIN employees employees_manager_manager ON employees_manager.manager_id = employees_manager_manager.id;
+
+ SELECT categories.label, categories_parent.label, categories_parent_parent.label FROM categories
+ JOIN categories categories_parent ON categories.parent_id = categories_parent.id
+ JOIN categories categories_parent_parent ON categories_parent.parent_id = categories_parent_parent.id;
+
+ SELECT employees.name, departments.title, employees_manager.name FROM employees
+ JOIN employees employees_manager ON employees.manager_id = employees_manager.id
+ JOIN departments ON employees.department_id = departments.id
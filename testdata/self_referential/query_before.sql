@@ -0,0 +1,11 @@
+-- join employees to itself for the manager's name, qualifying name since it's
+-- now ambiguous
+SELECT name, manager_id.name FROM employees;
+
+-- multi-hop self-joins, through the manager's manager
+SELECT e.name, manager_id.manager_id.name FROM employees e;
+
+-- self-joins and regular joins together
+SELECT label, parent_id.label, parent_id.parent_id.label FROM categories;
+
+SELECT name, title, manager_id.name FROM employees;
@@ -0,0 +1,17 @@
+CREATE TABLE departments (
+  id INT NOT NULL PRIMARY KEY,
+  title TEXT NOT NULL
+);
+
+CREATE TABLE employees (
+  id INT NOT NULL PRIMARY KEY,
+  name TEXT NOT NULL,
+  manager_id INT REFERENCES employees(id),
+  department_id INT NOT NULL REFERENCES departments(id)
+);
+
+CREATE TABLE categories (
+  id INT NOT NULL PRIMARY KEY,
+  label TEXT NOT NULL,
+  parent_id INT REFERENCES categories(id)
+);
@@ -0,0 +1,9 @@
+SELECT users.email, avatars.image_url FROM users
+ JOIN avatars ON avatars.user_id = users.id UNION SELECT users.email, posts.title FROM posts
+ JOIN users ON posts.author_id = users.id;
+
+ (SELECT title FROM posts INTERSECT SELECT avatars.image_url FROM users
+ JOIN avatars ON avatars.user_id = users.id) EXCEPT SELECT users.email FROM avatars
+ JOIN users ON avatars.user_id = users.id ORDER BY 1;
+
+ SELECT email FROM users WHERE id IN (SELECT author_id FROM posts UNION ALL SELECT user_id FROM avatars WHERE email = 'me@example.com')
@@ -0,0 +1,7 @@
+-- each SELECT of a set operation is joined on its own
+SELECT email, image_url FROM users UNION SELECT email, title FROM posts;
+
+SELECT title FROM posts INTERSECT SELECT image_url FROM users EXCEPT SELECT email FROM avatars ORDER BY 1;
+
+-- set operations in subqueries can still reference outer tables
+SELECT email FROM users WHERE id IN (SELECT author_id FROM posts UNION ALL SELECT user_id FROM avatars WHERE email = 'me@example.com');
@@ -0,0 +1,17 @@
+SELECT title, avatars.image_url FROM (SELECT title, author_id FROM posts) t JOIN users ON users.id = t.author_id
+ JOIN avatars ON avatars.user_id = users.id;
+
+ SELECT title FROM (SELECT posts.title, users.email FROM posts
+ JOIN users ON posts.author_id = users.id) t;
+
+ SELECT email FROM users WHERE EXISTS (SELECT 1 FROM posts
+ JOIN users users_2 ON posts.author_id = users_2.id
+ JOIN avatars ON avatars.user_id = users_2.id WHERE posts.author_id = users.id AND avatars.image_url = 'me.png');
+
+ SELECT posts.title, users.email FROM posts
+ JOIN users ON posts.author_id = users.id WHERE EXISTS (SELECT 1 FROM avatars WHERE avatars.user_id = users.id);
+
+ WITH counts AS (SELECT author_id, count(*) AS total FROM posts GROUP BY author_id) SELECT email, total FROM counts JOIN users ON users.id = counts.author_id;
+
+ SELECT users.email, avatars.image_url, p.title FROM users
+ JOIN avatars ON avatars.user_id = users.id, LATERAL (SELECT title FROM posts WHERE author_id = users.id) p
@@ -0,0 +1,17 @@
+-- joins are added to the subquery that needs them
+SELECT title, image_url FROM (SELECT title, author_id FROM posts) t JOIN users ON users.id = t.author_id;
+
+SELECT title FROM (SELECT title, email FROM posts) t;
+
+-- correlated subqueries can reference outer tables without joining them, and
+-- joins in the subquery don't hide them. Paths start at the subquery's own
+-- tables, so users is intentionally joined again (as users_2) to reach avatars
+SELECT email FROM users WHERE EXISTS (SELECT 1 FROM posts WHERE posts.author_id = users.id AND image_url = 'me.png');
+
+-- tables joined into the outer query can be referenced by correlated subqueries
+SELECT title, email FROM posts WHERE EXISTS (SELECT 1 FROM avatars WHERE avatars.user_id = users.id);
+
+-- CTE names are relations, not tables
+WITH counts AS (SELECT author_id, count(*) AS total FROM posts GROUP BY author_id) SELECT email, total FROM counts JOIN users ON users.id = counts.author_id;
+
+SELECT email, image_url, p.title FROM users, LATERAL (SELECT title FROM posts WHERE author_id = users.id) p;
@@ -0,0 +1,10 @@
+SELECT organizations.name, users.email FROM organizations
+ JOIN billing_accounts ON organizations.billing_account_id = billing_accounts.id
+ JOIN contacts ON billing_accounts.contact_id = contacts.id
+ JOIN users ON contacts.user_id = users.id;
+
+ SELECT organizations.name, user_profiles.bio FROM organizations
+ JOIN billing_accounts ON organizations.billing_account_id = billing_accounts.id
+ JOIN contacts ON billing_accounts.contact_id = contacts.id
+ JOIN users ON contacts.user_id = users.id
+ JOIN user_profiles ON user_profiles.user_id = users.id
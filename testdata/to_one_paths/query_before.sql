@@ -0,0 +1,6 @@
+-- organization_users is closer, but would return a row per member, so users
+-- is joined through billing_accounts and contacts instead
+SELECT name, email FROM organizations;
+
+-- user_profiles has one row per user, so this is to-one
+SELECT name, bio FROM organizations;
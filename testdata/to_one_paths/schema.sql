@@ -0,0 +1,34 @@
+CREATE TABLE users (
+  id INT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL
+);
+
+CREATE TABLE contacts (
+  id INT NOT NULL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id)
+);
+
+CREATE TABLE billing_accounts (
+  id INT NOT NULL PRIMARY KEY,
+  contact_id INT NOT NULL REFERENCES contacts(id)
+);
+
+CREATE TABLE organizations (
+  id INT NOT NULL PRIMARY KEY,
+  name TEXT NOT NULL,
+  billing_account_id INT NOT NULL REFERENCES billing_accounts(id)
+);
+
+CREATE TABLE organization_users (
+  organization_id INT NOT NULL REFERENCES organizations(id),
+  user_id INT NOT NULL REFERENCES users(id),
+  role TEXT NOT NULL,
+  PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE TABLE user_profiles (
+  user_id INT NOT NULL REFERENCES users(id),
+  bio TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX user_profiles_user_id_idx ON user_profiles (user_id);
@@ -0,0 +1,5 @@
+SELECT active_users.email, avatars.image_url FROM active_users
+ JOIN avatars ON avatars.user_id = active_users.id;
+
+ SELECT users.email, avatar_counts.avatar_count FROM users
+ JOIN avatar_counts ON avatar_counts.owner_id = users.id
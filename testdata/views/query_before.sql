@@ -0,0 +1,5 @@
+-- join active_users -> avatars, using the foreign key on avatars.user_id
+SELECT email, image_url FROM active_users;
+
+-- join users -> avatar_counts, using the foreign key on avatars.user_id
+SELECT email, avatar_count FROM users;
@@ -0,0 +1,20 @@
+CREATE TABLE users (
+  id INT NOT NULL PRIMARY KEY,
+  email TEXT NOT NULL,
+  active BOOLEAN NOT NULL
+);
+
+CREATE TABLE avatars (
+  id INT NOT NULL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id),
+  image_url TEXT NOT NULL
+);
+
+-- Views pass through users.id, so they can be joined like users.
+CREATE VIEW active_users AS
+  SELECT id, email FROM users WHERE active;
+
+-- Materialized views pass through avatars.user_id, so they can be joined to
+-- users, even when the column is renamed.
+CREATE MATERIALIZED VIEW avatar_counts AS
+  SELECT a.user_id AS owner_id, count(*) AS avatar_count FROM avatars a GROUP BY a.user_id;